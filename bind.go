@@ -0,0 +1,201 @@
+package qparser
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const bindTag = "qparser"
+
+var (
+	sortsType    = reflect.TypeOf([]Sort(nil))
+	includesType = reflect.TypeOf([]Include(nil))
+	pageType     = reflect.TypeOf((*Page)(nil))
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// BindInto populates the fields of the struct pointed to by dst according to the `qparser` struct tags
+// a tag has one of the following forms:
+//   - "filter,createdAt" binds the predicate of the filter by the field, "having,total" binds the having filter
+//     and "fields,articles" binds the fieldset of the resource type
+//   - "sort", "include" and "page" bind the parsed Sort, Includes and Page to the fields of the same types
+//   - a dot separated path of the top and nested keys e.g. "page.size" or "withTrashed" binds the raw value
+//
+// the values are converted to the type of the field: string, bool (see Values.Bool), integers, floats,
+// time.Duration, time.Time (see ParseTime), pointers to them, a slice receives all values
+// e.g. all predicates of the same field, absent params leave the fields untouched
+func (q *Query) BindInto(dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return errors.New("qparser: BindInto expects a non-nil pointer to a struct")
+	}
+	if q == nil {
+		return nil
+	}
+	v = v.Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup(bindTag)
+		if !ok || tag == "" || tag == "-" || sf.PkgPath != "" {
+			continue
+		}
+		if err := q.bindField(v.Field(i), tag); err != nil {
+			return fmt.Errorf("qparser: cannot bind %q to the field %s: %w", tag, sf.Name, err)
+		}
+	}
+	return nil
+}
+
+// bindField binds the value described by the tag to the field
+func (q *Query) bindField(field reflect.Value, tag string) error {
+	keyword, arg := cut(tag, ",")
+	if arg != "" {
+		switch keyword {
+		case filterKeyword:
+			return setStrings(field, predicates(q.Filters, arg))
+		case havingKeyword:
+			return setStrings(field, predicates(q.Having, arg))
+		case fieldsKeyword:
+			fields, _ := q.Fields.FieldsByResource(arg)
+			return setStrings(field, fields)
+		}
+		return fmt.Errorf("unknown keyword %q", keyword)
+	}
+	switch {
+	case tag == sortKeyword && field.Type() == sortsType:
+		field.Set(reflect.ValueOf(q.Sort))
+		return nil
+	case tag == includeKeyword && field.Type() == includesType:
+		field.Set(reflect.ValueOf(q.Includes))
+		return nil
+	case tag == pageKeyword && field.Type() == pageType:
+		field.Set(reflect.ValueOf(q.Page))
+		return nil
+	}
+	path := strings.Split(tag, ".")
+	return setStrings(field, matchingValues(q.Values, path[0], path[1:]...))
+}
+
+// predicates returns the predicates of the filters by the field name
+func predicates(filters []Filter, fieldName string) []string {
+	var list []string
+	for _, f := range filters {
+		if f.FieldName == fieldName {
+			list = append(list, f.Predicate)
+		}
+	}
+	return list
+}
+
+// matchingValues returns all values of the top key which have exactly the given nested keys
+func matchingValues(values Values, topKey string, nestedKeys ...string) []string {
+	var list []string
+	for _, item := range values[topKey] {
+		if len(item.NestedKeys) != len(nestedKeys) {
+			continue
+		}
+		match := true
+		for i, key := range nestedKeys {
+			if item.NestedKeys[i] != key {
+				match = false
+				break
+			}
+		}
+		if match {
+			list = append(list, item.Value)
+		}
+	}
+	return list
+}
+
+// setStrings converts the values to the type of the field, a slice receives all values
+// and any other type receives the first one, nil values leave the field untouched
+func setStrings(field reflect.Value, values []string) error {
+	if values == nil {
+		return nil
+	}
+	if field.Kind() == reflect.Slice {
+		slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+		for i, val := range values {
+			if err := setString(slice.Index(i), val); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+		return nil
+	}
+	return setString(field, values[0])
+}
+
+// setString converts the value to the type of the field
+// an empty value leaves the numeric and time fields untouched
+func setString(field reflect.Value, val string) error {
+	if field.Kind() == reflect.Ptr {
+		kind := field.Type().Elem().Kind()
+		if val == "" && kind != reflect.String && kind != reflect.Bool {
+			return nil
+		}
+		elem := reflect.New(field.Type().Elem())
+		if err := setString(elem.Elem(), val); err != nil {
+			return err
+		}
+		field.Set(elem)
+		return nil
+	}
+	if field.Kind() == reflect.String {
+		field.SetString(val)
+		return nil
+	}
+	if field.Kind() == reflect.Bool {
+		b, ok := parseBool(val)
+		if !ok {
+			return fmt.Errorf("%q is not a boolean value", val)
+		}
+		field.SetBool(b)
+		return nil
+	}
+	if val == "" {
+		return nil
+	}
+	switch {
+	case field.Type() == durationType:
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+	case field.Type() == timeType:
+		t, err := ParseTime(val)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(t))
+	case field.Kind() >= reflect.Int && field.Kind() <= reflect.Int64:
+		n, err := strconv.ParseInt(val, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case field.Kind() >= reflect.Uint && field.Kind() <= reflect.Uint64:
+		n, err := strconv.ParseUint(val, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case field.Kind() == reflect.Float32 || field.Kind() == reflect.Float64:
+		n, err := strconv.ParseFloat(val, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
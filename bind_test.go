@@ -0,0 +1,133 @@
+package qparser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bindTarget struct {
+	Title      string        `qparser:"filter,title"`
+	Tags       []string      `qparser:"filter,tag"`
+	CreatedAt  time.Time     `qparser:"filter,createdAt"`
+	Total      float64       `qparser:"having,total"`
+	Fields     []string      `qparser:"fields,articles"`
+	Sort       []Sort        `qparser:"sort"`
+	Includes   []Include     `qparser:"include"`
+	Page       *Page         `qparser:"page"`
+	Size       int           `qparser:"page.size"`
+	Number     *uint8        `qparser:"page.number"`
+	Limit      *int          `qparser:"page.limit"`
+	Trashed    bool          `qparser:"withTrashed"`
+	Timeout    time.Duration `qparser:"timeout"`
+	Style      string        `qparser:"style.top.color"`
+	Ignored    string        `qparser:"-"`
+	Untagged   string
+	unexported string `qparser:"format"`
+}
+
+func TestQueryBindInto(t *testing.T) {
+	const query = "filter[title]=hello&filter[tag]=a&filter[tag]=b&filter[createdAt]=2020-01-02" +
+		"&having[total]=100.5&fields[articles]=title,body&sort=-createdAt&include=author" +
+		"&page[size]=10&page[number]=2&page[limit]=&withTrashed&timeout=1m30s&style[top][color]=white&format=csv"
+	q, err := ParseQuery(query)
+	if err != nil {
+		t.Fatalf("ParseQuery(%q) returned error %v", query, err)
+	}
+	got := bindTarget{Ignored: "kept", Untagged: "kept"}
+	if err := q.BindInto(&got); err != nil {
+		t.Fatalf("BindInto() of %q returned error %v", query, err)
+	}
+	number := uint8(2)
+	expected := bindTarget{
+		Title:     "hello",
+		Tags:      []string{"a", "b"},
+		CreatedAt: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+		Total:     100.5,
+		Fields:    []string{"title", "body"},
+		Sort:      []Sort{{FieldName: "createdAt", Order: OrderDesc, ExplicitOrder: true}},
+		Includes:  []Include{{Relation: "author"}},
+		Page:      q.Page,
+		Size:      10,
+		Number:    &number,
+		Trashed:   true,
+		Timeout:   90 * time.Second,
+		Style:     "white",
+		Ignored:   "kept",
+		Untagged:  "kept",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("BindInto() of %q:\n\tgot  %+v\n\twant %+v\n", query, got, expected)
+	}
+
+	var empty bindTarget
+	q, _ = ParseQuery("")
+	if err := q.BindInto(&empty); err != nil || !reflect.DeepEqual(empty, bindTarget{}) {
+		t.Errorf("BindInto() of empty query returned %v and %+v, want zero struct", err, empty)
+	}
+}
+
+type bindIntoErrorTest struct {
+	in          string
+	dst         interface{}
+	errContains string
+}
+
+var bindIntoErrorTests = []bindIntoErrorTest{
+	{in: "", dst: nil, errContains: "non-nil pointer to a struct"},
+	{in: "", dst: bindTarget{}, errContains: "non-nil pointer to a struct"},
+	{in: "", dst: new(int), errContains: "non-nil pointer to a struct"},
+	{
+		in: "page[size]=big",
+		dst: &struct {
+			Size int `qparser:"page.size"`
+		}{},
+		errContains: `cannot bind "page.size" to the field Size`,
+	},
+	{
+		in: "page[size]=300",
+		dst: &struct {
+			Size int8 `qparser:"page.size"`
+		}{},
+		errContains: "value out of range",
+	},
+	{
+		in: "flag=maybe",
+		dst: &struct {
+			Flag bool `qparser:"flag"`
+		}{},
+		errContains: `"maybe" is not a boolean value`,
+	},
+	{
+		in: "x=1",
+		dst: &struct {
+			X complex64 `qparser:"x"`
+		}{},
+		errContains: "unsupported type complex64",
+	},
+	{
+		in: "",
+		dst: &struct {
+			X string `qparser:"unknown,x"`
+		}{},
+		errContains: `unknown keyword "unknown"`,
+	},
+}
+
+func TestQueryBindIntoErrors(t *testing.T) {
+	for _, tt := range bindIntoErrorTests {
+		q, err := ParseQuery(tt.in)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q) returned error %v", tt.in, err)
+		}
+		err = q.BindInto(tt.dst)
+		if err == nil {
+			t.Errorf("expected BindInto(%T) of %q to return error which contains %q, but nil is returned", tt.dst, tt.in, tt.errContains)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.errContains) {
+			t.Errorf(`BindInto(%T) of %q returned error %q, want something containing %q"`, tt.dst, tt.in, err, tt.errContains)
+		}
+	}
+}
@@ -0,0 +1,421 @@
+package qparser
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Encode serializes the query back into a query string
+// "fields", "filter", "include", "page" and "sort" parameters are built from the corresponding structures,
+// their values which are not parsed into the structures e.g. 'filter[price][gte]=10' or 'page[foo]=1'
+// and any other parameters are taken from the Values as is
+// the parameters are sorted by key, values of the same key preserve their order
+// the sort prefix and the include delimiters of the parser which produced the query are used
+func (q *Query) Encode() string {
+	if q == nil {
+		return ""
+	}
+	return encodePairs(q.pairs())
+}
+
+// String returns the encoded query, see Encode
+func (q *Query) String() string {
+	return q.Encode()
+}
+
+// ToURLValues converts the query into url.Values with the bracketed keys e.g. "filter[title]" or "page[size]",
+// the values are built the same way as by Encode, so ToURLValues().Encode() results in the same query string
+func (q *Query) ToURLValues() url.Values {
+	values := make(url.Values)
+	if q == nil {
+		return values
+	}
+	for _, p := range q.pairs() {
+		values[p.key] = append(values[p.key], p.value)
+	}
+	return values
+}
+
+// StringExcluding serializes the query like Encode, but emits only the parameters which are not present in the base
+// e.g. the defaults injected by a server, a parameter is compared by its key and value as a whole,
+// so "sort=-createdAt,title" is emitted entirely if the base has "sort=-createdAt"
+// a nil base results in the same output as Encode
+func (q *Query) StringExcluding(base *Query) string {
+	if q == nil {
+		return ""
+	}
+	pairs := q.pairs()
+	if base == nil {
+		return encodePairs(pairs)
+	}
+	excluded := make(map[pair]struct{})
+	for _, p := range base.pairs() {
+		excluded[p] = struct{}{}
+	}
+	diff := make([]pair, 0, len(pairs))
+	for _, p := range pairs {
+		if _, ok := excluded[p]; !ok {
+			diff = append(diff, p)
+		}
+	}
+	return encodePairs(diff)
+}
+
+// URL constructs the URL which consists of the path and the query string of the request
+// the path segments and the query are escaped
+func (r *Request) URL() (*url.URL, error) {
+	segments, err := r.pathSegments()
+	if err != nil {
+		return nil, err
+	}
+	escaped := make([]string, len(segments))
+	for i, segment := range segments {
+		escaped[i] = url.PathEscape(segment)
+	}
+	u := &url.URL{
+		Path: "/" + strings.Join(segments, "/"),
+	}
+	if rawPath := "/" + strings.Join(escaped, "/"); rawPath != u.Path {
+		u.RawPath = rawPath
+	}
+	u.RawQuery = r.Query.Encode()
+	return u, nil
+}
+
+// Path returns the canonical path of the request e.g. "/articles/1/relationships/author",
+// each segment is escaped, an empty string is returned if the path cannot be built, see URL for the errors
+func (r *Request) Path() string {
+	u, err := r.URL()
+	if err != nil {
+		return ""
+	}
+	return u.EscapedPath()
+}
+
+// String returns the canonical path followed by the encoded query e.g. "/articles/1/comments?sort=-createdAt",
+// it is useful for the self-links, an empty string is returned if the path cannot be built
+func (r *Request) String() string {
+	u, err := r.URL()
+	if err != nil {
+		return ""
+	}
+	return u.String()
+}
+
+// pathSegments returns the unescaped path segments of the request
+func (r *Request) pathSegments() ([]string, error) {
+	if r == nil {
+		return nil, errors.New("qparser: cannot build path, request is nil")
+	}
+	if r.Resource.Type == "" {
+		return nil, errors.New("qparser: cannot build path, resource type is empty")
+	}
+	var segments []string
+	if r.Version != "" {
+		segments = append(segments, r.Version)
+	}
+	segments = append(segments, r.Resource.Type)
+	if r.Resource.ID == "" {
+		if r.RelationshipType != "" || r.RelatedResourceType != "" || len(r.NestedResources) > 0 {
+			return nil, errors.New("qparser: cannot build path, resource id is required for a relationship request")
+		}
+		return segments, nil
+	}
+	segments = append(segments, r.Resource.ID)
+	for _, nested := range r.NestedResources {
+		if nested.Type == "" || nested.ID == "" {
+			return nil, errors.New("qparser: cannot build path, nested resource type and id are required")
+		}
+		segments = append(segments, nested.Type, nested.ID)
+	}
+	switch {
+	case r.RelationshipType != "" && r.RelatedResourceType != "":
+		return nil, errors.New("qparser: cannot build path, both relationship and related resource types are set")
+	case r.RelationshipType != "":
+		segments = append(segments, relationshipsRequest, r.RelationshipType)
+	case r.RelatedResourceType != "":
+		segments = append(segments, r.RelatedResourceType)
+	}
+	return segments, nil
+}
+
+// querySyntax holds the parser settings which are needed to encode and interpret the query the way it was parsed
+type querySyntax struct {
+	sortDescPrefix          string
+	relationDelimiter       string
+	nestedRelationDelimiter string
+	fieldsDelimiter         string
+	sortDelimiter           string
+	operatorInKey           bool
+
+	pageKeyword    string
+	sortKeyword    string
+	filterKeyword  string
+	includeKeyword string
+	fieldsKeyword  string
+	orderKeyword   string
+	havingKeyword  string
+	// selectKeyword is set only if the select alias is applied to the fields, see WithSelectKeyword
+	selectKeyword  string
+	includeAliases []string
+}
+
+var defaultQuerySyntax = querySyntax{
+	sortDescPrefix:          string(sortDescChar),
+	relationDelimiter:       string(relationDelimiter),
+	nestedRelationDelimiter: string(nestedRelationDelimiter),
+	fieldsDelimiter:         fieldsDelimiter,
+	sortDelimiter:           string(sortDelimiter),
+
+	pageKeyword:    pageKeyword,
+	sortKeyword:    sortKeyword,
+	filterKeyword:  filterKeyword,
+	includeKeyword: includeKeyword,
+	fieldsKeyword:  fieldsKeyword,
+	havingKeyword:  havingKeyword,
+}
+
+// newQuerySyntax returns the syntax of the options, nil is returned for the default syntax
+func newQuerySyntax(opts *options) *querySyntax {
+	syntax := querySyntax{
+		sortDescPrefix:          opts.sortDescPrefix,
+		relationDelimiter:       opts.relationDelimiter,
+		nestedRelationDelimiter: opts.nestedRelationDelimiter,
+		fieldsDelimiter:         opts.fieldsDelimiter,
+		sortDelimiter:           opts.sortDelimiter,
+		operatorInKey:           opts.operatorInKey,
+
+		pageKeyword:    opts.pageKeyword,
+		sortKeyword:    opts.sortKeyword,
+		filterKeyword:  opts.filterKeyword,
+		includeKeyword: opts.includeKeyword,
+		fieldsKeyword:  opts.fieldsKeyword,
+		orderKeyword:   opts.orderKeyword,
+		havingKeyword:  opts.havingKeyword,
+		includeAliases: opts.includeAliases,
+	}
+	if reflect.DeepEqual(syntax, defaultQuerySyntax) {
+		return nil
+	}
+	return &syntax
+}
+
+// pair is a single key=value setting of a query string, the key and the value are not escaped
+type pair struct {
+	key   string
+	value string
+}
+
+// pairs builds a list of key=value settings which represent the query
+func (q *Query) pairs() []pair {
+	pairs := make([]pair, 0)
+	syntax := q.syntax
+	if syntax == nil {
+		syntax = &defaultQuerySyntax
+	}
+
+	resources := make([]string, 0, len(q.Fields)+len(q.ExcludedFields))
+	for resource := range q.Fields {
+		resources = append(resources, resource)
+	}
+	for resource := range q.ExcludedFields {
+		if _, ok := q.Fields[resource]; !ok {
+			resources = append(resources, resource)
+		}
+	}
+	for _, resource := range resources {
+		list := make([]string, 0, len(q.Fields[resource])+len(q.ExcludedFields[resource]))
+		list = append(list, q.Fields[resource]...)
+		for _, field := range q.ExcludedFields[resource] {
+			list = append(list, string(fieldExcludeChar)+field)
+		}
+		pairs = append(pairs, pair{
+			key:   valueKey(syntax.fieldsKeyword, resource),
+			value: strings.Join(list, syntax.fieldsDelimiter),
+		})
+	}
+
+	for _, filter := range q.Filters {
+		pairs = append(pairs, pair{key: valueKey(syntax.filterKeyword, filter.FieldName), value: filter.Predicate})
+	}
+
+	if len(q.Includes) > 0 || len(q.ExcludedIncludes) > 0 {
+		paths := make([]string, 0, len(q.Includes)+len(q.ExcludedIncludes))
+		for _, include := range q.Includes {
+			paths = appendIncludePaths(paths, syntax.nestedRelationDelimiter, include)
+		}
+		for _, include := range q.ExcludedIncludes {
+			excluded := appendIncludePaths(nil, syntax.nestedRelationDelimiter, include)
+			for _, path := range excluded {
+				paths = append(paths, string(includeExcludeChar)+path)
+			}
+		}
+		pairs = append(pairs, pair{key: syntax.includeKeyword, value: strings.Join(paths, syntax.relationDelimiter)})
+	}
+
+	if q.Page != nil {
+		pagePairs := []pair{
+			{key: "size", value: q.Page.Size},
+			{key: "number", value: q.Page.Number},
+			{key: "limit", value: q.Page.Limit},
+			{key: "offset", value: q.Page.Offset},
+			{key: "cursor", value: q.Page.Cursor},
+			{key: "direction", value: q.Page.CursorDirection},
+			{key: "from", value: q.Page.From},
+			{key: "to", value: q.Page.To},
+		}
+		for _, p := range pagePairs {
+			if p.value != "" {
+				pairs = append(pairs, pair{key: valueKey(syntax.pageKeyword, p.key), value: p.value})
+			}
+		}
+	}
+
+	if len(q.Sort) > 0 {
+		// the fields without the prefix get the descending direction from the order keyword which is kept in the values
+		order, _ := scalarValue(q.Values, syntax.orderKeyword)
+		defaultDesc := syntax.orderKeyword != "" && strings.EqualFold(order, "desc")
+		list := make([]string, 0, len(q.Sort))
+		for _, s := range q.Sort {
+			field := s.FieldName
+			if s.Func != "" {
+				field = s.Func + "(" + field + ")"
+			}
+			prefixed := field != "" && field[0] == sortAscChar || strings.HasPrefix(field, syntax.sortDescPrefix)
+			switch {
+			case s.Order == OrderDesc && defaultDesc && !s.ExplicitOrder && !prefixed:
+				// the direction is given by the order keyword
+			case s.Order == OrderDesc:
+				field = syntax.sortDescPrefix + field
+			case s.ExplicitOrder, prefixed, defaultDesc:
+				// the field name which starts with a prefix is kept by the explicit ascending prefix,
+				// the ascending prefix also keeps the field from being overridden by the order keyword
+				field = string(sortAscChar) + field
+			}
+			switch s.NullsOrder {
+			case NullsFirst:
+				field += nullsFirstSuffix
+			case NullsLast:
+				field += nullsLastSuffix
+			}
+			list = append(list, field)
+		}
+		pairs = append(pairs, pair{key: syntax.sortKeyword, value: strings.Join(list, syntax.sortDelimiter)})
+	}
+
+	for topKey, list := range q.Values {
+		structured := syntax.isStructuredKeyword(topKey)
+		for _, val := range list {
+			if structured && syntax.isParsedValue(topKey, val) {
+				continue
+			}
+			pairs = append(pairs, pair{key: valueKey(val.TopLevelKey, val.NestedKeys...), value: val.Value})
+		}
+	}
+
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].key < pairs[j].key
+	})
+	return pairs
+}
+
+// isStructuredKeyword reports whether the keyword is encoded from the Query structures rather than from the Values,
+// see isParsedValue
+func (s *querySyntax) isStructuredKeyword(keyword string) bool {
+	switch keyword {
+	case s.fieldsKeyword, s.filterKeyword, s.includeKeyword, s.pageKeyword, s.sortKeyword:
+		return true
+	}
+	return s.selectKeyword != "" && keyword == s.selectKeyword || s.isIncludeAlias(keyword)
+}
+
+// isIncludeAlias reports whether the keyword is one of the include aliases, see WithIncludeAliases
+func (s *querySyntax) isIncludeAlias(keyword string) bool {
+	for _, alias := range s.includeAliases {
+		if alias == keyword {
+			return true
+		}
+	}
+	return false
+}
+
+// isParsedValue reports whether the value of the structured keyword is represented by the Query structures,
+// the rest such as 'filter[price][gte]=10' (see UnparsedFilters) or 'page[foo]=1' is encoded as is
+func (s *querySyntax) isParsedValue(keyword string, val Value) bool {
+	switch keyword {
+	case s.fieldsKeyword:
+		return len(val.NestedKeys) == 1
+	case s.filterKeyword:
+		return val.Value != "" && isFilterShape(val.NestedKeys, s.operatorInKey)
+	case s.includeKeyword, s.sortKeyword:
+		return val.Value != "" && len(val.NestedKeys) == 0
+	case s.pageKeyword:
+		return len(val.NestedKeys) == 1 && isPageParam(val.NestedKeys[0])
+	}
+	// the relations of the include aliases are merged into the includes
+	if s.isIncludeAlias(keyword) {
+		return val.Value != "" && len(val.NestedKeys) == 0
+	}
+	// the selected fields are encoded as the fieldset of the resource type
+	return s.selectKeyword != "" && keyword == s.selectKeyword && len(val.NestedKeys) == 0
+}
+
+// appendIncludePaths appends the paths to the leaves of the include tree, the relations are joined with sep
+// e.g. Include{Relation: "comments", Includes: []Include{{Relation: "author"}}} results in "comments.author"
+// the tree is walked iteratively, so an arbitrary deep include does not grow the stack
+func appendIncludePaths(paths []string, sep string, include Include) []string {
+	type node struct {
+		prefix  string
+		include *Include
+	}
+	stack := []node{{include: &include}}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		path := n.include.Relation
+		if n.prefix != "" {
+			path = n.prefix + sep + path
+		}
+		if len(n.include.Includes) == 0 {
+			paths = append(paths, path)
+			continue
+		}
+		// push in the reverse order to preserve the order of the nested includes
+		for i := len(n.include.Includes) - 1; i >= 0; i-- {
+			stack = append(stack, node{prefix: path, include: &n.include.Includes[i]})
+		}
+	}
+	return paths
+}
+
+// valueKey builds the query param name from the top and nested keys e.g. "page", "size" results in "page[size]"
+func valueKey(topKey string, nestedKeys ...string) string {
+	if len(nestedKeys) == 0 {
+		return topKey
+	}
+	var b strings.Builder
+	b.WriteString(topKey)
+	for _, key := range nestedKeys {
+		b.WriteByte(openBracket)
+		b.WriteString(key)
+		b.WriteByte(closeBracket)
+	}
+	return b.String()
+}
+
+// encodePairs joins the pairs into a query string, keys and values are escaped
+func encodePairs(pairs []pair) string {
+	var b strings.Builder
+	for _, p := range pairs {
+		if b.Len() > 0 {
+			b.WriteByte('&')
+		}
+		b.WriteString(url.QueryEscape(p.key))
+		b.WriteByte('=')
+		b.WriteString(url.QueryEscape(p.value))
+	}
+	return b.String()
+}
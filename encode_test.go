@@ -0,0 +1,622 @@
+package qparser
+
+import (
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type requestURLTest struct {
+	in          *Request
+	out         string
+	errContains string
+}
+
+var requestURLTests = []requestURLTest{
+	{
+		in:  &Request{Resource: Resource{Type: "articles"}},
+		out: "/articles",
+	},
+	{
+		in:  &Request{Resource: Resource{Type: "articles", ID: "42"}},
+		out: "/articles/42",
+	},
+	{
+		in: &Request{
+			Resource:            Resource{Type: "articles", ID: "42"},
+			RelatedResourceType: "author",
+		},
+		out: "/articles/42/author",
+	},
+	{
+		in: &Request{
+			Resource:         Resource{Type: "articles", ID: "42"},
+			RelationshipType: "comments",
+		},
+		out: "/articles/42/relationships/comments",
+	},
+	{
+		in:  &Request{Resource: Resource{Type: "files", ID: "a/b c?"}},
+		out: "/files/a%2Fb%20c%3F",
+	},
+	{
+		in: &Request{
+			Resource: Resource{Type: "articles"},
+			Query: &Query{
+				Sort:    []Sort{{FieldName: "createdAt", Order: OrderDesc, ExplicitOrder: true}},
+				Filters: []Filter{{FieldName: "title", Predicate: "eq:a&b"}},
+			},
+		},
+		out: "/articles?filter%5Btitle%5D=eq%3Aa%26b&sort=-createdAt",
+	},
+	{
+		in: &Request{
+			Resource: Resource{Type: "articles"},
+			Query: &Query{
+				Sort: []Sort{
+					{FieldName: "createdAt", Order: OrderDesc, NullsOrder: NullsLast, ExplicitOrder: true},
+					{FieldName: "title", NullsOrder: NullsFirst},
+				},
+			},
+		},
+		out: "/articles?sort=-createdAt.nullslast%2Ctitle.nullsfirst",
+	},
+	{
+		in:          &Request{},
+		errContains: "resource type is empty",
+	},
+	{
+		in: &Request{
+			Resource:            Resource{Type: "articles"},
+			RelatedResourceType: "author",
+		},
+		errContains: "resource id is required",
+	},
+	{
+		in: &Request{
+			Resource:            Resource{Type: "articles", ID: "1"},
+			RelatedResourceType: "author",
+			RelationshipType:    "author",
+		},
+		errContains: "both relationship and related resource types are set",
+	},
+}
+
+func TestRequestURL(t *testing.T) {
+	for _, tt := range requestURLTests {
+		u, err := tt.in.URL()
+		if err != nil && tt.errContains == "" {
+			t.Errorf("Request%+v.URL() returned unexpected error %s", tt.in, err)
+			continue
+		}
+		if err == nil && tt.errContains != "" {
+			t.Errorf(
+				"expected Request%+v.URL() to return error which contains %q, but nil is returned",
+				tt.in,
+				tt.errContains,
+			)
+			continue
+		}
+		if err != nil {
+			if !strings.Contains(err.Error(), tt.errContains) {
+				t.Errorf(
+					`Request%+v.URL() returned error %q, want something containing %q"`,
+					tt.in,
+					err,
+					tt.errContains,
+				)
+			}
+			continue
+		}
+		if r := u.String(); r != tt.out {
+			t.Errorf("Request%+v.URL():\n\tgot  %s\n\twant %s\n", tt.in, r, tt.out)
+		}
+	}
+}
+
+func TestRequestURLParse(t *testing.T) {
+	const request = "/articles/42/relationships/comments?fields[comments]=author,-secret&include=author,comments.author&page[size]=10&custom[key]=value"
+
+	parsed, err := ParseRequest(request)
+	if err != nil {
+		t.Fatalf("ParseRequest(%q) returned error %v", request, err)
+	}
+	u, err := parsed.URL()
+	if err != nil {
+		t.Fatalf("Request%+v.URL() returned error %v", parsed, err)
+	}
+	reparsed, err := ParseRequest(u.String())
+	if err != nil {
+		t.Fatalf("ParseRequest(%q) returned error %v", u.String(), err)
+	}
+	if !reflect.DeepEqual(parsed, reparsed) {
+		t.Errorf(
+			"ParseRequest(%q) is not equal to the original request:\n\tgot  %+v\n\twant %+v\n",
+			u.String(),
+			reparsed,
+			parsed,
+		)
+	}
+}
+
+type stringExcludingTest struct {
+	in   string
+	base string
+	out  string
+}
+
+var stringExcludingTests = []stringExcludingTest{
+	{
+		in:   "page[size]=10&page[number]=2&sort=-createdAt",
+		base: "page[size]=10&sort=-createdAt",
+		out:  "page%5Bnumber%5D=2",
+	},
+	{
+		in:   "sort=-createdAt,title&filter[a]=1&filter[a]=2",
+		base: "sort=-createdAt&filter[a]=1",
+		out:  "filter%5Ba%5D=2&sort=-createdAt%2Ctitle",
+	},
+	{
+		in:   "page[size]=10&custom=1",
+		base: "page[size]=10&custom=1",
+		out:  "",
+	},
+	{
+		in:   "include=author",
+		base: "",
+		out:  "include=author",
+	},
+	{
+		in:   "filter[price][gte]=10&page[foo]=1&sort=a",
+		base: "sort=a",
+		out:  "filter%5Bprice%5D%5Bgte%5D=10&page%5Bfoo%5D=1",
+	},
+}
+
+func TestQueryStringExcluding(t *testing.T) {
+	for _, tt := range stringExcludingTests {
+		q, err := ParseQuery(tt.in)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q) returned error %v", tt.in, err)
+		}
+		base, err := ParseQuery(tt.base)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q) returned error %v", tt.base, err)
+		}
+		if r := q.StringExcluding(base); r != tt.out {
+			t.Errorf("StringExcluding of %q with base %q returned %q, want %q", tt.in, tt.base, r, tt.out)
+		}
+	}
+
+	q, _ := ParseQuery("sort=title")
+	if r := q.StringExcluding(nil); r != "sort=title" {
+		t.Errorf("StringExcluding(nil) returned %q, want %q", r, "sort=title")
+	}
+	var nilQuery *Query
+	if r := nilQuery.StringExcluding(q); r != "" {
+		t.Errorf("StringExcluding of nil query returned %q, want empty string", r)
+	}
+}
+
+func TestQueryToURLValues(t *testing.T) {
+	const query = "fields[articles]=title,-secret&filter[title]=eq:a%26b&filter[title]=ne:c&include=comments.author" +
+		"&page[size]=10&sort=-createdAt&custom[key]=value&flag"
+	q, err := ParseQuery(query)
+	if err != nil {
+		t.Fatalf("ParseQuery(%q) returned error %v", query, err)
+	}
+	expected := url.Values{
+		"fields[articles]": {"title,-secret"},
+		"filter[title]":    {"eq:a&b", "ne:c"},
+		"include":          {"comments.author"},
+		"page[size]":       {"10"},
+		"sort":             {"-createdAt"},
+		"custom[key]":      {"value"},
+		"flag":             {""},
+	}
+	values := q.ToURLValues()
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("ToURLValues() of %q:\n\tgot  %+v\n\twant %+v\n", query, values, expected)
+	}
+	if encoded := values.Encode(); encoded != q.Encode() {
+		t.Errorf("ToURLValues().Encode() of %q returned %q, want %q", query, encoded, q.Encode())
+	}
+	reparsed, err := ParseQuery(values.Encode())
+	if err != nil {
+		t.Fatalf("ParseQuery(%q) returned error %v", values.Encode(), err)
+	}
+	if !reflect.DeepEqual(reparsed, q) {
+		t.Errorf("ParseQuery(%q) is not equal to the original query:\n\tgot  %+v\n\twant %+v\n", values.Encode(), reparsed, q)
+	}
+
+	var nilQuery *Query
+	if values := nilQuery.ToURLValues(); values == nil || len(values) != 0 {
+		t.Errorf("ToURLValues() of nil query returned %+v, want empty values", values)
+	}
+}
+
+type exclusionsTest struct {
+	in                  string
+	outIncludes         []Include
+	outExcludedIncludes []Include
+	outFields           ResourceFields
+	outExcludedFields   ResourceFields
+}
+
+// the excluded includes and the excluded fields share the '-' prefix, they must not interfere with each other
+// and both must survive the serialization
+var exclusionsTests = []exclusionsTest{
+	{
+		in:                  "include=-comments&fields[articles]=-secret",
+		outExcludedIncludes: []Include{{Relation: "comments"}},
+		outExcludedFields:   ResourceFields{"articles": {"secret"}},
+	},
+	{
+		in: "include=author,-comments.likes&fields[articles]=title,-secret&fields[people]=-email",
+		outIncludes: []Include{
+			{Relation: "author"},
+		},
+		outExcludedIncludes: []Include{
+			{Relation: "comments", Includes: []Include{{Relation: "likes"}}},
+		},
+		outFields:         ResourceFields{"articles": {"title"}},
+		outExcludedFields: ResourceFields{"articles": {"secret"}, "people": {"email"}},
+	},
+	{
+		in:                  "fields[comments]=-body&include=-comments",
+		outExcludedIncludes: []Include{{Relation: "comments"}},
+		outExcludedFields:   ResourceFields{"comments": {"body"}},
+	},
+	{
+		in:                  "include=comments.author,-comments.likes,-&fields[comments]=body",
+		outIncludes:         []Include{{Relation: "comments", Includes: []Include{{Relation: "author"}}}},
+		outExcludedIncludes: []Include{{Relation: "comments", Includes: []Include{{Relation: "likes"}}}},
+		outFields:           ResourceFields{"comments": {"body"}},
+	},
+}
+
+func TestExclusionsRoundTrip(t *testing.T) {
+	for _, tt := range exclusionsTests {
+		q, err := ParseQuery(tt.in)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q) returned error %v", tt.in, err)
+		}
+		if !reflect.DeepEqual(q.Includes, tt.outIncludes) {
+			t.Errorf("ParseQuery(%q) includes:\n\tgot  %+v\n\twant %+v\n", tt.in, q.Includes, tt.outIncludes)
+		}
+		if !reflect.DeepEqual(q.ExcludedIncludes, tt.outExcludedIncludes) {
+			t.Errorf("ParseQuery(%q) excluded includes:\n\tgot  %+v\n\twant %+v\n", tt.in, q.ExcludedIncludes, tt.outExcludedIncludes)
+		}
+		if !reflect.DeepEqual(q.Fields, tt.outFields) {
+			t.Errorf("ParseQuery(%q) fields:\n\tgot  %+v\n\twant %+v\n", tt.in, q.Fields, tt.outFields)
+		}
+		if !reflect.DeepEqual(q.ExcludedFields, tt.outExcludedFields) {
+			t.Errorf("ParseQuery(%q) excluded fields:\n\tgot  %+v\n\twant %+v\n", tt.in, q.ExcludedFields, tt.outExcludedFields)
+		}
+		encoded := q.Encode()
+		reparsed, err := ParseQuery(encoded)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q) returned error %v", encoded, err)
+		}
+		if !reflect.DeepEqual(reparsed.Includes, q.Includes) ||
+			!reflect.DeepEqual(reparsed.ExcludedIncludes, q.ExcludedIncludes) ||
+			!reflect.DeepEqual(reparsed.Fields, q.Fields) ||
+			!reflect.DeepEqual(reparsed.ExcludedFields, q.ExcludedFields) {
+			t.Errorf("ParseQuery(%q) is not equal to the original query:\n\tgot  %+v\n\twant %+v\n", encoded, reparsed, q)
+		}
+	}
+}
+
+func TestRequestStringRoundTrip(t *testing.T) {
+	for _, tt := range pathTests {
+		if tt.out == nil {
+			continue
+		}
+		r := *tt.out
+		r.Query, _ = ParseQuery("include=author&sort=-createdAt&filter[title]=eq:a%2Fb")
+		s := r.String()
+		if path := r.Path(); !strings.HasPrefix(s, path+"?") {
+			t.Errorf("String() of %q returned %q, want the path %q followed by the query", tt.in, s, path)
+		}
+		parsed, err := ParseRequest(s)
+		if err != nil {
+			t.Errorf("ParseRequest(%q) returned error %v", s, err)
+			continue
+		}
+		if got, want := structured(parsed.Query), structured(r.Query); !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseRequest(%q) returned query:\n\tgot  %+v\n\twant %+v\n", s, got, want)
+		}
+		parsed.Query = nil
+		if !reflect.DeepEqual(parsed, tt.out) {
+			t.Errorf("ParseRequest(%q) of the path of %q:\n\tgot  %+v\n\twant %+v\n", s, tt.in, parsed, tt.out)
+		}
+	}
+}
+
+type requestPathTest struct {
+	in  *Request
+	out string
+}
+
+var requestPathTests = []requestPathTest{
+	{in: nil, out: ""},
+	{in: &Request{}, out: ""},
+	{in: &Request{Resource: Resource{Type: "articles"}}, out: "/articles"},
+	{in: &Request{Resource: Resource{Type: "articles", ID: "a/b c?"}}, out: "/articles/a%2Fb%20c%3F"},
+	{in: &Request{Resource: Resource{Type: "articles", ID: "1"}, RelatedResourceType: "comments"}, out: "/articles/1/comments"},
+	{
+		in:  &Request{Resource: Resource{Type: "articles", ID: "1"}, RelationshipType: "comments"},
+		out: "/articles/1/relationships/comments",
+	},
+	{in: &Request{Resource: Resource{Type: "articles"}, RelationshipType: "comments"}, out: ""},
+}
+
+func TestRequestPath(t *testing.T) {
+	for _, tt := range requestPathTests {
+		if path := tt.in.Path(); path != tt.out {
+			t.Errorf("Path() of %+v returned %q, want %q", tt.in, path, tt.out)
+		}
+		if s := tt.in.String(); s != tt.out {
+			t.Errorf("String() of %+v without query returned %q, want %q", tt.in, s, tt.out)
+		}
+	}
+}
+
+type queryEncodeTest struct {
+	in   string
+	opts []Option
+	out  string
+}
+
+var queryEncodeTests = []queryEncodeTest{
+	{in: "", out: ""},
+	{in: "filter[title]=eq:a&filter[title]=ne:b", out: "filter%5Btitle%5D=eq%3Aa&filter%5Btitle%5D=ne%3Ab"},
+	{in: "x=1&include=author&filter[b]=2&filter[a]=1", out: "filter%5Ba%5D=1&filter%5Bb%5D=2&include=author&x=1"},
+	{
+		in:  "page[size]=10&page[number]=2&fields[people]=name&fields[articles]=title",
+		out: "fields%5Barticles%5D=title&fields%5Bpeople%5D=name&page%5Bnumber%5D=2&page%5Bsize%5D=10",
+	},
+	{
+		in: "sort=-createdAt,title&page[size]=10&filter[title]=eq:a%20b&include=author,comments.author&fields[articles]=title,body",
+		out: "fields%5Barticles%5D=title%2Cbody&filter%5Btitle%5D=eq%3Aa+b&include=author%2Ccomments.author" +
+			"&page%5Bsize%5D=10&sort=-createdAt%2Ctitle",
+	},
+	{
+		in:  "filter[price][gte]=10&page[foo]=1&page[size]=5&sort=a",
+		out: "filter%5Bprice%5D%5Bgte%5D=10&page%5Bfoo%5D=1&page%5Bsize%5D=5&sort=a",
+	},
+	{
+		in:   "with=author,comments&include=comments.author&expand=tags",
+		opts: []Option{WithIncludeAliases("with", "expand")},
+		out:  "include=comments.author%2Cauthor%2Ctags",
+	},
+	{
+		in:   "with=&with[x]=a&include=author",
+		opts: []Option{WithIncludeAliases("with")},
+		out:  "include=author&with=&with%5Bx%5D=a",
+	},
+	{
+		in:  "filter=1&filter[a]=&include[x]=a&fields=title&sort[x]=a",
+		out: "fields=title&filter=1&filter%5Ba%5D=&include%5Bx%5D=a&sort%5Bx%5D=a",
+	},
+}
+
+func TestQueryEncode(t *testing.T) {
+	for _, tt := range queryEncodeTests {
+		q, err := NewParser(tt.opts...).ParseQuery(tt.in)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) returned error %v", tt.in, err)
+			continue
+		}
+		if encoded := q.Encode(); encoded != tt.out {
+			t.Errorf("Encode() of %q:\n\tgot  %q\n\twant %q\n", tt.in, encoded, tt.out)
+		}
+	}
+}
+
+// roundTripQueries are parsed, encoded and parsed again, the structured parts of the queries must be equal
+var roundTripQueries = []string{
+	"",
+	"include=author",
+	"include=comments.author,comments.tags,author",
+	"include=comments.author&include=comments",
+	"fields[articles]=title,body&fields[people]=name",
+	"fields[articles]=title,-secret,body",
+	"fields[articles]=-secret",
+	"fields[articles]=",
+	"fields[articles]=*",
+	"sort=-createdAt,title",
+	"sort=-createdAt.nullslast,title.nullsfirst",
+	"sort=a,,b,-,,c",
+	"sort=title,-title",
+	"sort=%2BcreatedAt,%2B%2Bname,%2B-slug",
+	"filter[title]=eq:foo",
+	"filter[title]=eq:a&b",
+	"filter[b]=1&filter[a]=2",
+	"filter[title]=like:%25foo%25",
+	"filter[title]=a+b",
+	"filter[name]=eq:a%2Cb",
+	"filter[author.name]=eq:x",
+	"filter[a]=1&filter[a]=2",
+	"filter[title]=eq:a&filter[title]=ne:b",
+	"having[total]=gt:100",
+	"page[size]=10&page[number]=2",
+	"page[limit]=10&page[offset]=20",
+	"page[cursor]=YWJjZA==",
+	"page[from]=2020-01-01&page[to]=2020-02-01",
+	"page[size]=all",
+	"format=csv",
+	"withTrashed",
+	"withTrashed=false",
+	"locale=en-US",
+	"counts=comments,tags",
+	"profile=https://example.com/a+https://example.com/b",
+	"ids=1,2&ids[]=3",
+	"custom[a][b]=1&custom=2",
+	"q=%C3%A9t%C3%A9",
+	"empty",
+	"?include=author&fields[people]=name&sort=-createdAt&filter[title]=eq:foo&page[size]=5",
+	"filter[a%5Db]=1",
+	"filter[a%5Bb]=1",
+	"filter[a]]=1",
+	"filter[%20]=1",
+	"filter[title]=a%3Bb",
+	"filter[title]=%26%3D",
+	"a%26b=c",
+	"a%5Bb=c",
+	"sort=lower(title)",
+	"include=comments%2Cauthor",
+	"include=a..b",
+	"include=a.b.c&include=a.d",
+	"fields[a%5Db]=x",
+	"page[size]=%2010",
+	"counts=Comments,comments",
+}
+
+// structured returns a copy of the query without the raw values, so the parsed structures can be compared,
+// the raw values may be normalized by the encoding, they are compared for rawRoundTripQueries
+func structured(q *Query) Query {
+	s := *q
+	s.Values = nil
+	s.OrderedValues = nil
+	s.Filters = sortedFilters(q.Filters)
+	s.Having = sortedFilters(q.Having)
+	return s
+}
+
+// sortedFilters returns the filters sorted by the field name, the encoded filters are ordered by the key
+func sortedFilters(filters []Filter) []Filter {
+	if filters == nil {
+		return nil
+	}
+	sorted := append([]Filter{}, filters...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].FieldName < sorted[j].FieldName
+	})
+	return sorted
+}
+
+func TestQueryRoundTrip(t *testing.T) {
+	for _, in := range roundTripQueries {
+		q, err := ParseQuery(in)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) returned error %v", in, err)
+			continue
+		}
+		encoded := q.String()
+		reparsed, err := ParseQuery(encoded)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) of the encoded %q returned error %v", encoded, in, err)
+			continue
+		}
+		if got, want := structured(reparsed), structured(q); !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseQuery(%q) of the encoded %q:\n\tgot  %#v\n\twant %#v\n", encoded, in, got, want)
+		}
+		fromURLValues, err := ParseQuery(q.ToURLValues().Encode())
+		if err != nil {
+			t.Errorf("ParseQuery() of ToURLValues() of %q returned error %v", in, err)
+			continue
+		}
+		if got, want := structured(fromURLValues), structured(q); !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseQuery() of ToURLValues() of %q:\n\tgot  %#v\n\twant %#v\n", in, got, want)
+		}
+		if again := reparsed.String(); again != encoded {
+			t.Errorf("String() of %q is not stable:\n\tgot  %q\n\twant %q\n", in, again, encoded)
+		}
+	}
+}
+
+// rawRoundTripQueries keep the raw values on the round trip as well, including the values of the structured keywords
+// which are not parsed into the structures, the parameters are given in the encoded order
+var rawRoundTripQueries = []string{
+	"filter[a][b]=1",
+	"filter[a][b]=1&filter[c]=2",
+	"filter=x&filter[title]=eq:a",
+	"filter[a]=",
+	"page[foo]=1",
+	"page[foo]=1&page[size]=10",
+	"page[size][x]=1",
+	"include=author&include[x]=a",
+	"fields=title&fields[articles]=body",
+	"sort=a&sort[x]=b",
+}
+
+func TestQueryRoundTripValues(t *testing.T) {
+	for _, in := range rawRoundTripQueries {
+		q, err := ParseQuery(in)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) returned error %v", in, err)
+			continue
+		}
+		encoded := q.String()
+		reparsed, err := ParseQuery(encoded)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) of the encoded %q returned error %v", encoded, in, err)
+			continue
+		}
+		if !reflect.DeepEqual(reparsed.Values, q.Values) {
+			t.Errorf("ParseQuery(%q) of the encoded %q:\n\tgot values  %+v\n\twant values %+v\n", encoded, in, reparsed.Values, q.Values)
+		}
+		if got, want := structured(reparsed), structured(q); !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseQuery(%q) of the encoded %q:\n\tgot  %#v\n\twant %#v\n", encoded, in, got, want)
+		}
+	}
+}
+
+type optionsRoundTripTest struct {
+	in   string
+	opts []Option
+}
+
+var optionsRoundTripTests = []optionsRoundTripTest{
+	{in: "sort=-lower(title),createdAt", opts: []Option{WithSortFunctions(true)}},
+	{in: "aggr[total]=gt:100&having[x]=1", opts: []Option{WithHavingKeyword("aggr")}},
+	{in: "id[]=1&id=2", opts: []Option{WithIDsKeyword("id")}},
+	{in: "include=Author.Posts", opts: []Option{WithIncludeCase(IncludeCaseLower)}},
+	{in: "with=author&include=tags", opts: []Option{WithIncludeAliases("with")}},
+	{in: "page[size]=-1", opts: []Option{WithUnboundedPageSize("-1")}},
+	{in: "sort=!createdAt,title,-name", opts: []Option{WithSortDescPrefix("!")}},
+	{in: "sort=%2Bname,title,-slug&order=desc", opts: []Option{WithOrderKeyword("order")}},
+	{in: "filter[price][gte]=10&filter[price][lte]=100", opts: []Option{WithOperatorInKey(true)}},
+	{in: "include=comments/author|tags", opts: []Option{WithIncludeDelimiters('|', '/')}},
+	{
+		in:   "sort=-createdAt|title&fields[articles]=title|-secret|body",
+		opts: []Option{WithSortDelimiter('|'), WithFieldsDelimiter('|')},
+	},
+	{
+		in: "pagination[size]=10&order=-title&where[a]=1&with=author&only[people]=name&page[size]=5",
+		opts: []Option{
+			WithPageKeyword("pagination"),
+			WithSortKeyword("order"),
+			WithFilterKeyword("where"),
+			WithIncludeKeyword("with"),
+			WithFieldsKeyword("only"),
+		},
+	},
+	{
+		in:   "include=comments/author|tags&sort=desc:title",
+		opts: []Option{WithIncludeDelimiters('|', '/'), WithSortDescPrefix("desc:")},
+	},
+}
+
+func TestQueryRoundTripOptions(t *testing.T) {
+	for _, tt := range optionsRoundTripTests {
+		p := NewParser(tt.opts...)
+		q, err := p.ParseQuery(tt.in)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) returned error %v", tt.in, err)
+			continue
+		}
+		encoded := q.String()
+		reparsed, err := p.ParseQuery(encoded)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) of the encoded %q returned error %v", encoded, tt.in, err)
+			continue
+		}
+		if got, want := structured(reparsed), structured(q); !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseQuery(%q) of the encoded %q:\n\tgot  %#v\n\twant %#v\n", encoded, tt.in, got, want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package qparser
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// the sentinel errors classify the parse failures, the returned errors keep the detailed message
+// and match the sentinel with errors.Is e.g. errors.Is(err, qparser.ErrInvalidPath)
+var (
+	// ErrEmptyPath is returned if the request path is empty or consists of slashes only
+	ErrEmptyPath = errors.New("qparser: empty path")
+	// ErrInvalidPath is returned if the request path does not match the supported formats
+	ErrInvalidPath = errors.New("qparser: invalid path")
+	// ErrQueryTooLong is returned if the query exceeds the length set by WithMaxQueryLength
+	ErrQueryTooLong = errors.New("qparser: query is too long")
+	// ErrMalformedQuery is returned if the query cannot be split into params, e.g. a bad escape sequence,
+	// an invalid UTF-8 string or a malformed param name (see KeySyntaxError)
+	ErrMalformedQuery = errors.New("qparser: malformed query")
+	// ErrLimitExceeded is returned if a configured limit of the number of values, nested keys or fields is exceeded
+	ErrLimitExceeded = errors.New("qparser: limit exceeded")
+	// ErrInvalidValue is returned if a param value is not accepted e.g. a non-integer page size,
+	// an unknown operator or a malformed locale
+	ErrInvalidValue = errors.New("qparser: invalid value")
+)
+
+// sentinelError is an error with the detailed message which unwraps to the sentinel error
+type sentinelError struct {
+	sentinel error
+	msg      string
+}
+
+func (e *sentinelError) Error() string {
+	return e.msg
+}
+
+func (e *sentinelError) Unwrap() error {
+	return e.sentinel
+}
+
+// wrapError formats the detailed message of the error classified by the sentinel
+func wrapError(sentinel error, format string, args ...interface{}) error {
+	return &sentinelError{sentinel: sentinel, msg: fmt.Sprintf(format, args...)}
+}
+
+// ValidationError describes a violation of the constraints of a request
+// Param is the name of the violated parameter e.g. "filter", "sort", "include", "fields", "page[size]"
+// Resource and Field identify the offending resource type and field if applicable
+type ValidationError struct {
+	Param    string
+	Resource string
+	Field    string
+	Msg      string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("qparser: %s: %s", e.Param, e.Msg)
+}
+
+// JSONAPIErrorDocument is the top-level JSON:API document which contains the error objects
+type JSONAPIErrorDocument struct {
+	Errors []JSONAPIError `json:"errors"`
+}
+
+// JSONAPIError is the JSON:API error object, see https://jsonapi.org/format/#error-objects
+// Status is the HTTP status code as a string, Code is the application specific code e.g. "invalid_path"
+type JSONAPIError struct {
+	Status string              `json:"status"`
+	Code   string              `json:"code"`
+	Title  string              `json:"title"`
+	Detail string              `json:"detail"`
+	Source *JSONAPIErrorSource `json:"source,omitempty"`
+}
+
+// JSONAPIErrorSource points to the query parameter which caused the error
+type JSONAPIErrorSource struct {
+	Parameter string `json:"parameter,omitempty"`
+}
+
+// jsonAPIErrorKinds maps the sentinel errors to the HTTP status and the error code
+var jsonAPIErrorKinds = []struct {
+	sentinel error
+	status   int
+	code     string
+}{
+	{sentinel: ErrEmptyPath, status: http.StatusNotFound, code: "empty_path"},
+	{sentinel: ErrInvalidPath, status: http.StatusNotFound, code: "invalid_path"},
+	{sentinel: ErrQueryTooLong, status: http.StatusRequestURITooLong, code: "query_too_long"},
+	{sentinel: ErrMalformedQuery, status: http.StatusBadRequest, code: "malformed_query"},
+	{sentinel: ErrLimitExceeded, status: http.StatusBadRequest, code: "limit_exceeded"},
+	{sentinel: ErrInvalidValue, status: http.StatusBadRequest, code: "invalid_value"},
+}
+
+// ToJSONAPIError converts the parse failure to the JSON:API error document, nil is returned for the nil error
+// the sentinel errors and *ValidationError are mapped to the corresponding status and code,
+// the path violations of *ValidationError result in the "404 Not Found" status,
+// any other error results in the "400 Bad Request" status and the "bad_request" code
+// the detail is the error message without the "qparser: " prefix
+func ToJSONAPIError(err error) *JSONAPIErrorDocument {
+	if err == nil {
+		return nil
+	}
+	obj := JSONAPIError{
+		Status: strconv.Itoa(http.StatusBadRequest),
+		Code:   "bad_request",
+		Title:  http.StatusText(http.StatusBadRequest),
+		Detail: strings.TrimPrefix(err.Error(), "qparser: "),
+	}
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		obj.Code = "validation_failed"
+		if validationErr.Param == "path" {
+			obj.Status = strconv.Itoa(http.StatusNotFound)
+			obj.Title = http.StatusText(http.StatusNotFound)
+		} else {
+			obj.Source = &JSONAPIErrorSource{Parameter: validationErr.Param}
+		}
+		return &JSONAPIErrorDocument{Errors: []JSONAPIError{obj}}
+	}
+	for _, kind := range jsonAPIErrorKinds {
+		if errors.Is(err, kind.sentinel) {
+			obj.Status = strconv.Itoa(kind.status)
+			obj.Code = kind.code
+			obj.Title = http.StatusText(kind.status)
+			break
+		}
+	}
+	return &JSONAPIErrorDocument{Errors: []JSONAPIError{obj}}
+}
@@ -0,0 +1,125 @@
+package qparser
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type sentinelErrorTest struct {
+	in       string
+	opts     []Option
+	sentinel error
+}
+
+var sentinelErrorTests = []sentinelErrorTest{
+	{in: "", sentinel: ErrEmptyPath},
+	{in: "///", sentinel: ErrEmptyPath},
+	{in: "/articles/1/comments/5/author", sentinel: ErrInvalidPath},
+	{in: "/articles/1/links/author", sentinel: ErrInvalidPath},
+	{in: "/articles/%zz", sentinel: ErrInvalidPath},
+	{in: "/articles?sort=title", opts: []Option{WithMaxQueryLength(5)}, sentinel: ErrQueryTooLong},
+	{in: "/articles?filter[title=a", opts: []Option{WithStrict(true)}, sentinel: ErrMalformedQuery},
+	{in: "/articles?%zz=a", sentinel: ErrMalformedQuery},
+	{in: "/articles?sort=a&sort=b", opts: []Option{WithMaxValuesPerKey(1)}, sentinel: ErrLimitExceeded},
+	{in: "/articles?format=xml", opts: []Option{WithAllowedFormats("json")}, sentinel: ErrInvalidValue},
+	{in: "/articles?page[direction]=back", opts: []Option{WithStrict(true)}, sentinel: ErrInvalidValue},
+}
+
+func TestSentinelErrors(t *testing.T) {
+	for _, tt := range sentinelErrorTests {
+		_, err := NewParser(tt.opts...).ParseRequest(tt.in)
+		if !errors.Is(err, tt.sentinel) {
+			t.Errorf("ParseRequest(%q) returned error %v, want %v", tt.in, err, tt.sentinel)
+		}
+	}
+
+	page := &Page{Size: "ten"}
+	if _, err := page.SizeInt(); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("Page.SizeInt() of %q returned error %v, want %v", page.Size, err, ErrInvalidValue)
+	}
+}
+
+type jsonAPIErrorTest struct {
+	in  error
+	out *JSONAPIErrorDocument
+}
+
+var jsonAPIErrorTests = []jsonAPIErrorTest{
+	{in: nil, out: nil},
+	{
+		in: wrapError(ErrEmptyPath, "qparser: empty path is given, path must have 1-4 segments"),
+		out: &JSONAPIErrorDocument{Errors: []JSONAPIError{{
+			Status: "404",
+			Code:   "empty_path",
+			Title:  "Not Found",
+			Detail: "empty path is given, path must have 1-4 segments",
+		}}},
+	},
+	{
+		in: wrapError(ErrQueryTooLong, "qparser: query is too long, the maximum length is %d bytes", 5),
+		out: &JSONAPIErrorDocument{Errors: []JSONAPIError{{
+			Status: "414",
+			Code:   "query_too_long",
+			Title:  "Request URI Too Long",
+			Detail: "query is too long, the maximum length is 5 bytes",
+		}}},
+	},
+	{
+		in: &KeySyntaxError{Key: "filter[title", Pos: 12, Msg: "unclosed '['"},
+		out: &JSONAPIErrorDocument{Errors: []JSONAPIError{{
+			Status: "400",
+			Code:   "malformed_query",
+			Title:  "Bad Request",
+			Detail: `malformed query param name "filter[title": unclosed '[' at position 12`,
+		}}},
+	},
+	{
+		in: &ValidationError{Param: "sort", Field: "secret", Msg: `sorting by "secret" is not allowed`},
+		out: &JSONAPIErrorDocument{Errors: []JSONAPIError{{
+			Status: "400",
+			Code:   "validation_failed",
+			Title:  "Bad Request",
+			Detail: `sort: sorting by "secret" is not allowed`,
+			Source: &JSONAPIErrorSource{Parameter: "sort"},
+		}}},
+	},
+	{
+		in: &ValidationError{Param: "path", Resource: "comments", Msg: `unknown resource type "comments"`},
+		out: &JSONAPIErrorDocument{Errors: []JSONAPIError{{
+			Status: "404",
+			Code:   "validation_failed",
+			Title:  "Not Found",
+			Detail: `path: unknown resource type "comments"`,
+		}}},
+	},
+	{
+		in: errors.New("unexpected failure"),
+		out: &JSONAPIErrorDocument{Errors: []JSONAPIError{{
+			Status: "400",
+			Code:   "bad_request",
+			Title:  "Bad Request",
+			Detail: "unexpected failure",
+		}}},
+	},
+}
+
+func TestToJSONAPIError(t *testing.T) {
+	for _, tt := range jsonAPIErrorTests {
+		doc := ToJSONAPIError(tt.in)
+		if !reflect.DeepEqual(doc, tt.out) {
+			t.Errorf("ToJSONAPIError(%v):\n\tgot  %+v\n\twant %+v\n", tt.in, doc, tt.out)
+		}
+	}
+
+	doc := ToJSONAPIError(&ValidationError{Param: "include", Msg: "too deep"})
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("json.Marshal(%+v) returned error %v", doc, err)
+	}
+	expected := `{"errors":[{"status":"400","code":"validation_failed","title":"Bad Request","detail":"include: too deep","source":{"parameter":"include"}}]}`
+	if string(data) != expected {
+		t.Errorf("JSON of the error document:\n\tgot  %s\n\twant %s\n", data, expected)
+	}
+}
@@ -0,0 +1,126 @@
+package qparser
+
+// ResolvedFields returns the effective fieldsets of the primary resource type and of the types of the included
+// relations according to the JSON:API sparse fieldsets rules: the type without a fieldset or with the wildcard
+// is represented by the wildcard which means all fields, otherwise the requested list is returned
+// e.g. "include=author" results in {"people": ["*"]} and "include=author&fields[people]=name" in {"people": ["name"]}
+// includeTypes maps the dot separated include paths to the resource types e.g. "comments.author": "people",
+// the last relation name of a path is used as the type if the path is not in the map
+// the include path which has its own fieldset e.g. "fields[comments.author]=name" is resolved against it
+// and keyed by the path instead of the type, see FieldsByPath
+// the excluded fields are removed from the requested list, the wildcard can not be narrowed,
+// so they follow it with the exclusion prefix e.g. "fields[articles]=-body" results in {"articles": ["*", "-body"]}
+// empty resourceType skips the primary resource
+func (q *Query) ResolvedFields(resourceType string, includeTypes map[string]string) ResourceFields {
+	if q == nil {
+		return nil
+	}
+	// keys are the types or the include paths which have their own fieldsets
+	keys := make([]string, 0, len(q.Includes)+1)
+	if resourceType != "" {
+		keys = append(keys, resourceType)
+	}
+	for _, path := range includePaths(q.Includes) {
+		if _, ok := q.Fields[path]; ok && isRelationPath(path) {
+			keys = append(keys, path)
+			continue
+		}
+		typ, ok := includeTypes[path]
+		if !ok {
+			_, typ = lastRelation(path)
+		}
+		keys = append(keys, typ)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	resolved := make(ResourceFields, len(keys))
+	for _, key := range keys {
+		if _, exist := resolved[key]; exist {
+			continue
+		}
+		excluded := q.ExcludedFields[key]
+		if q.Fields.AllRequested(key) {
+			fields := make([]string, 0, len(excluded)+1)
+			fields = append(fields, fieldsWildcard)
+			for _, field := range excluded {
+				fields = append(fields, string(fieldExcludeChar)+field)
+			}
+			resolved[key] = fields
+			continue
+		}
+		requested, _ := q.Fields.FieldsByResource(key)
+		fields := make([]string, 0, len(requested))
+		for _, field := range requested {
+			if !contains(excluded, field) {
+				fields = append(fields, field)
+			}
+		}
+		resolved[key] = fields
+	}
+	return resolved
+}
+
+// includePaths returns the dot separated paths of all nodes of the include tree in the depth-first order
+// e.g. "include=comments.author,tags" results in "comments", "comments.author", "tags"
+func includePaths(includes []Include) []string {
+	return joinedIncludePaths(includes, string(nestedRelationDelimiter))
+}
+
+// joinedIncludePaths works like includePaths, but the relations are joined with the given separator
+func joinedIncludePaths(includes []Include, sep string) []string {
+	type node struct {
+		path    string
+		include *Include
+	}
+	var paths []string
+	stack := make([]node, 0, len(includes))
+	for i := len(includes) - 1; i >= 0; i-- {
+		stack = append(stack, node{path: includes[i].Relation, include: &includes[i]})
+	}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		paths = append(paths, n.path)
+		for i := len(n.include.Includes) - 1; i >= 0; i-- {
+			nested := &n.include.Includes[i]
+			stack = append(stack, node{path: n.path + sep + nested.Relation, include: nested})
+		}
+	}
+	return paths
+}
+
+// IncludesEqual reports whether the include trees are equal regardless of the order of the siblings,
+// the includes are compared as sets, so duplicated siblings are not taken into account
+func IncludesEqual(a, b []Include) bool {
+	// the separator can not be a part of a relation name, so the paths are unambiguous
+	const sep = "\x00"
+	pathsA := joinedIncludePaths(a, sep)
+	pathsB := joinedIncludePaths(b, sep)
+	set := make(map[string]bool, len(pathsA))
+	for _, path := range pathsA {
+		set[path] = false
+	}
+	for _, path := range pathsB {
+		if _, ok := set[path]; !ok {
+			return false
+		}
+		set[path] = true
+	}
+	for _, matched := range set {
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// lastRelation splits the include path into the parent path and the last relation name
+func lastRelation(path string) (parent, relation string) {
+	for i := len(path) - 1; i >= 0; i-- {
+		if path[i] == nestedRelationDelimiter {
+			return path[:i], path[i+1:]
+		}
+	}
+	return "", path
+}
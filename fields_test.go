@@ -0,0 +1,159 @@
+package qparser
+
+import (
+	"reflect"
+	"testing"
+)
+
+type resolvedFieldsTest struct {
+	in           string
+	resourceType string
+	includeTypes map[string]string
+	out          ResourceFields
+}
+
+var resolvedFieldsTests = []resolvedFieldsTest{
+	{
+		in:           "",
+		resourceType: "",
+		out:          nil,
+	},
+	{
+		in:           "",
+		resourceType: "articles",
+		out:          ResourceFields{"articles": {"*"}},
+	},
+	{
+		in:           "include=author&fields[articles]=title",
+		resourceType: "articles",
+		includeTypes: map[string]string{"author": "people"},
+		out:          ResourceFields{"articles": {"title"}, "people": {"*"}},
+	},
+	{
+		in:           "include=author&fields[people]=name",
+		resourceType: "articles",
+		includeTypes: map[string]string{"author": "people"},
+		out:          ResourceFields{"articles": {"*"}, "people": {"name"}},
+	},
+	{
+		in:           "include=comments.author&fields[people]=*&fields[comments]=body",
+		resourceType: "articles",
+		includeTypes: map[string]string{"comments.author": "people"},
+		out:          ResourceFields{"articles": {"*"}, "comments": {"body"}, "people": {"*"}},
+	},
+	{
+		in:           "include=tags&fields[tags]=name&fields[unrelated]=x",
+		resourceType: "",
+		out:          ResourceFields{"tags": {"name"}},
+	},
+	{
+		in:           "include=comments.author&fields[comments.author]=name&fields[people]=email",
+		resourceType: "articles",
+		includeTypes: map[string]string{"comments.author": "people"},
+		out:          ResourceFields{"articles": {"*"}, "comments": {"*"}, "comments.author": {"name"}},
+	},
+	{
+		in:           "include=author,comments.author&fields[comments.author]=name&fields[people]=email",
+		resourceType: "articles",
+		includeTypes: map[string]string{"author": "people", "comments.author": "people"},
+		out: ResourceFields{
+			"articles":        {"*"},
+			"comments":        {"*"},
+			"comments.author": {"name"},
+			"people":          {"email"},
+		},
+	},
+	{
+		in:           "include=author&fields[articles]=title,body,-body&fields[people]=-email",
+		resourceType: "articles",
+		includeTypes: map[string]string{"author": "people"},
+		out:          ResourceFields{"articles": {"title"}, "people": {"*", "-email"}},
+	},
+	{
+		in:           "fields[articles]=-body,-secret",
+		resourceType: "articles",
+		out:          ResourceFields{"articles": {"*", "-body", "-secret"}},
+	},
+}
+
+func TestQueryResolvedFields(t *testing.T) {
+	for _, tt := range resolvedFieldsTests {
+		q, err := ParseQuery(tt.in)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q) returned error %v", tt.in, err)
+		}
+		if r := q.ResolvedFields(tt.resourceType, tt.includeTypes); !reflect.DeepEqual(r, tt.out) {
+			t.Errorf("ResolvedFields(%q) of %q:\n\tgot  %+v\n\twant %+v\n", tt.resourceType, tt.in, r, tt.out)
+		}
+	}
+
+	var nilQuery *Query
+	if r := nilQuery.ResolvedFields("articles", nil); r != nil {
+		t.Errorf("ResolvedFields() of nil query returned %+v, want nil", r)
+	}
+}
+
+type includesEqualTest struct {
+	a   []Include
+	b   []Include
+	out bool
+}
+
+var includesEqualTests = []includesEqualTest{
+	{a: nil, b: nil, out: true},
+	{a: nil, b: []Include{}, out: true},
+	{a: []Include{{Relation: "author"}}, b: nil, out: false},
+	{
+		a:   []Include{{Relation: "author"}, {Relation: "tags"}},
+		b:   []Include{{Relation: "tags"}, {Relation: "author"}},
+		out: true,
+	},
+	{
+		a: []Include{
+			{Relation: "comments", Includes: []Include{{Relation: "author"}, {Relation: "likes"}}},
+			{Relation: "tags"},
+		},
+		b: []Include{
+			{Relation: "tags"},
+			{Relation: "comments", Includes: []Include{{Relation: "likes"}, {Relation: "author"}}},
+		},
+		out: true,
+	},
+	{
+		a:   []Include{{Relation: "comments", Includes: []Include{{Relation: "author"}}}},
+		b:   []Include{{Relation: "comments"}},
+		out: false,
+	},
+	{
+		a:   []Include{{Relation: "comments", Includes: []Include{{Relation: "author"}}}},
+		b:   []Include{{Relation: "author", Includes: []Include{{Relation: "comments"}}}},
+		out: false,
+	},
+	{
+		a:   []Include{{Relation: "a.b"}},
+		b:   []Include{{Relation: "a", Includes: []Include{{Relation: "b"}}}},
+		out: false,
+	},
+	{
+		a:   []Include{{Relation: "author"}, {Relation: "author"}},
+		b:   []Include{{Relation: "author"}},
+		out: true,
+	},
+}
+
+func TestIncludesEqual(t *testing.T) {
+	for _, tt := range includesEqualTests {
+		if r := IncludesEqual(tt.a, tt.b); r != tt.out {
+			t.Errorf("IncludesEqual(%+v, %+v) returned %t, want %t", tt.a, tt.b, r, tt.out)
+		}
+		if r := IncludesEqual(tt.b, tt.a); r != tt.out {
+			t.Errorf("IncludesEqual(%+v, %+v) returned %t, want %t", tt.b, tt.a, r, tt.out)
+		}
+	}
+
+	a, _ := ParseQuery("include=comments.author,tags,comments.likes")
+	b, _ := ParseQuery("include=tags,comments.likes,comments.author")
+	if !IncludesEqual(a.Includes, b.Includes) {
+		t.Errorf("IncludesEqual() of the reordered includes returned false, want true")
+	}
+}
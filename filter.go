@@ -0,0 +1,445 @@
+package qparser
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	operatorDelimiter = ':'
+	fieldRefPrefix    = "field:"
+	listDelimiter     = ','
+	quoteChar         = '"'
+	escapeChar        = '\\'
+)
+
+// typeHints is a set of the type names recognized between the operator and the value e.g. 'gt:int:18'
+var typeHints = map[string]struct{}{
+	"int":    {},
+	"float":  {},
+	"bool":   {},
+	"string": {},
+	"time":   {},
+	"date":   {},
+}
+
+// commonTimeLayouts is a list of layouts tried by ParseTime when no layout is given
+var commonTimeLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// ParseTime parses the value using the given layouts, the first successfully parsed result is returned
+// if no layouts are given then the common layouts are tried: RFC 3339 (with and without nanoseconds),
+// "2006-01-02T15:04:05", "2006-01-02 15:04:05" and "2006-01-02"
+func ParseTime(value string, layouts ...string) (time.Time, error) {
+	if len(layouts) == 0 {
+		layouts = commonTimeLayouts
+	}
+	var err error
+	for _, layout := range layouts {
+		var t time.Time
+		t, err = time.Parse(layout, value)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("qparser: failed to parse time %q: %w", value, err)
+}
+
+// Time parses the predicate value as time using the given layouts (see ParseTime)
+// the predicate may be prefixed by an operator e.g. 'filter[createdAt]=gt:2020-01-02T15:04:05Z',
+// in such case the part after the first colon is parsed
+func (f Filter) Time(layouts ...string) (time.Time, error) {
+	t, err := ParseTime(f.Predicate, layouts...)
+	if err == nil {
+		return t, nil
+	}
+	if _, value, ok := f.Operator(); ok {
+		if t, opErr := ParseTime(value, layouts...); opErr == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("qparser: filter[%s]: %w", f.FieldName, err)
+}
+
+// UnparsedFilters returns the raw "filter" values which do not fit the standard shape 'filter[field]=predicate',
+// i.e. the values with zero or more than one nested key, in the order of appearance
+// the 'filter[field][operator]=value' shape is parsed if the WithOperatorInKey option is enabled
+// such values are not present in the Filters, gateways may forward them verbatim
+func (q *Query) UnparsedFilters() []Value {
+	if q == nil {
+		return nil
+	}
+	syntax := q.syntax
+	if syntax == nil {
+		syntax = &defaultQuerySyntax
+	}
+	var unparsed []Value
+	for _, val := range q.Values[syntax.filterKeyword] {
+		if !isFilterShape(val.NestedKeys, syntax.operatorInKey) {
+			unparsed = append(unparsed, val)
+		}
+	}
+	return unparsed
+}
+
+// Operator splits the predicate into the operator and the value
+// the operator is everything before the first colon and the value is the remainder
+// e.g. 'filter[title]=like:a:b' results in "like", "a:b", true
+// if there is no colon then the operator is empty, the value equals the whole predicate and ok is false
+func (f Filter) Operator() (op string, value string, ok bool) {
+	i := strings.IndexByte(f.Predicate, operatorDelimiter)
+	if i < 0 {
+		return "", f.Predicate, false
+	}
+	return f.Predicate[:i], f.Predicate[i+1:], true
+}
+
+// FieldRef returns the name of the field the value refers to, e.g. 'filter[startDate]=lt:field:endDate' compares
+// two fields and results in "endDate", true
+// the operator is split first, so the "field:" prefix is recognized only in the value after the operator,
+// a predicate without an operator such as "field:endDate" is the "field" operator with the "endDate" value
+func (f Filter) FieldRef() (refField string, ok bool) {
+	_, value, hasOp := f.Operator()
+	if !hasOp || !strings.HasPrefix(value, fieldRefPrefix) || len(value) == len(fieldRefPrefix) {
+		return "", false
+	}
+	return value[len(fieldRefPrefix):], true
+}
+
+// TypeHint returns the type the value should be coerced to, the predicate follows the op:type:value grammar
+// e.g. 'filter[age]=gt:int:18' or 'filter[active]=eq:bool:true' results in "int", true
+// only the known type names are recognized: int, float, bool, string, time, date,
+// so 'filter[title]=like:a:b' has no type hint, the value is the remainder after the hint
+func (f Filter) TypeHint() (typ string, ok bool) {
+	_, value, hasOp := f.Operator()
+	if !hasOp {
+		return "", false
+	}
+	i := strings.IndexByte(value, operatorDelimiter)
+	if i < 0 {
+		return "", false
+	}
+	if _, known := typeHints[value[:i]]; !known {
+		return "", false
+	}
+	return value[:i], true
+}
+
+// UsedOperators returns the distinct operators of the filters in the order of appearance
+// filters without an operator are skipped as well as the prefixes which are not operator names
+// e.g. "2020-01-01T10" of the predicate "2020-01-01T10:00:00Z", see isOperatorName
+func (q *Query) UsedOperators() []string {
+	if q == nil {
+		return nil
+	}
+	var operators []string
+	seen := make(map[string]struct{})
+	for _, f := range q.Filters {
+		op, _, ok := f.Operator()
+		if !ok || !isOperatorName(op) {
+			continue
+		}
+		if _, exist := seen[op]; exist {
+			continue
+		}
+		seen[op] = struct{}{}
+		operators = append(operators, op)
+	}
+	return operators
+}
+
+// FiltersByField groups the filters by the field name, filters of a field keep the order of appearance
+// the map iteration order is random, use FilterFields to walk the groups deterministically
+func (q *Query) FiltersByField() map[string][]Filter {
+	if q == nil || len(q.Filters) == 0 {
+		return nil
+	}
+	groups := make(map[string][]Filter)
+	for _, f := range q.Filters {
+		groups[f.FieldName] = append(groups[f.FieldName], f)
+	}
+	return groups
+}
+
+// FilterMap maps the field names to the predicates of the filters, predicates of a field keep the order of appearance
+// the map is a snapshot, it is not updated when the Filters are changed
+func (q *Query) FilterMap() map[string][]string {
+	if q == nil || len(q.Filters) == 0 {
+		return nil
+	}
+	predicates := make(map[string][]string)
+	for _, f := range q.Filters {
+		predicates[f.FieldName] = append(predicates[f.FieldName], f.Predicate)
+	}
+	return predicates
+}
+
+// FilterFields returns the distinct field names of the filters in the order of the first appearance
+// e.g. "filter[b]=1&filter[a]=2&filter[b]=3" results in []string{"b", "a"}
+func (q *Query) FilterFields() []string {
+	if q == nil {
+		return nil
+	}
+	var fields []string
+	seen := make(map[string]struct{})
+	for _, f := range q.Filters {
+		if _, exist := seen[f.FieldName]; exist {
+			continue
+		}
+		seen[f.FieldName] = struct{}{}
+		fields = append(fields, f.FieldName)
+	}
+	return fields
+}
+
+// FilterGroup contains the filters of the same field, the filters of a group are meant to be combined by OR
+type FilterGroup struct {
+	FieldName string
+	Filters   []Filter
+}
+
+// FilterGroups groups the filters by the field in the order of the first appearance, the filters of a group
+// are meant to be combined by OR and the groups are meant to be combined by AND
+// e.g. "filter[status]=eq:a&filter[type]=eq:c&filter[status]=eq:b" means (status = a OR status = b) AND type = c
+// the Filters slice remains available for the callers which interpret the filters differently
+func (q *Query) FilterGroups() []FilterGroup {
+	if q == nil || len(q.Filters) == 0 {
+		return nil
+	}
+	var groups []FilterGroup
+	index := make(map[string]int)
+	for _, f := range q.Filters {
+		i, exist := index[f.FieldName]
+		if !exist {
+			i = len(groups)
+			index[f.FieldName] = i
+			groups = append(groups, FilterGroup{FieldName: f.FieldName})
+		}
+		groups[i].Filters = append(groups[i].Filters, f)
+	}
+	return groups
+}
+
+// RangeFor pairs the lower and the upper bounds of the field e.g. 'filter[price][gte]=10&filter[price][lte]=100'
+// (see WithOperatorInKey) or 'filter[price]=gte:10&filter[price]=lte:100' results in "10", "100", true
+// the "gt" and "gte" operators set the lower bound, the "lt" and "lte" operators set the upper bound,
+// the "between" operator sets both e.g. 'filter[price]=between:10,100', the last filter wins if a bound is repeated
+// ok is false if the field has no bounds, a bound which is not set is empty, so the range may be open
+func (q *Query) RangeFor(field string) (lo, hi string, ok bool) {
+	if q == nil {
+		return "", "", false
+	}
+	for _, f := range q.Filters {
+		if f.FieldName != field {
+			continue
+		}
+		op, value, _ := f.Operator()
+		switch op {
+		case "gt", "gte":
+			lo, ok = value, true
+		case "lt", "lte":
+			hi, ok = value, true
+		case "between":
+			from, to := cut(value, string(listDelimiter))
+			lo, hi, ok = from, to, true
+		}
+	}
+	return lo, hi, ok
+}
+
+// ScopedFilters returns the filters of the relation scope in the order of appearance,
+// the scope prefix is removed from the field names e.g. with the "author" scope
+// "filter[author.name]=eq:bob" results in Filter{FieldName: "name", Predicate: "eq:bob", Op: "eq", Value: "bob"}
+// nested scopes are separated with the dot as well e.g. "comments.author"
+func (q *Query) ScopedFilters(scope string) []Filter {
+	if q == nil {
+		return nil
+	}
+	prefix := scope + string(nestedRelationDelimiter)
+	var filters []Filter
+	for _, f := range q.Filters {
+		if strings.HasPrefix(f.FieldName, prefix) && len(f.FieldName) > len(prefix) {
+			f.FieldName = f.FieldName[len(prefix):]
+			filters = append(filters, f)
+		}
+	}
+	return filters
+}
+
+// NumberWithUnit splits the predicate value (the operator is skipped) into a number and a trailing alphabetic unit
+// e.g. 'filter[size]=gt:10MB' results in 10, "MB", spaces between the number and the unit are allowed
+// the unit is empty if the value has no unit, an error is returned if the rest of the value is not a number
+func (f Filter) NumberWithUnit() (num float64, unit string, err error) {
+	_, value, _ := f.Operator()
+	i := len(value)
+	for i > 0 {
+		r, size := utf8.DecodeLastRuneInString(value[:i])
+		if !unicode.IsLetter(r) {
+			break
+		}
+		i -= size
+	}
+	unit = value[i:]
+	number := strings.TrimRightFunc(value[:i], unicode.IsSpace)
+	num, err = strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("qparser: filter[%s]: %q is not a number with a unit", f.FieldName, value)
+	}
+	return num, unit, nil
+}
+
+// JSON unmarshals the predicate value into dst, the predicate may be prefixed by an operator
+// e.g. 'filter[geo]=near:{"lat":1,"lng":2}', the whole predicate is used if it is a valid JSON by itself
+// since a JSON object contains colons as well
+func (f Filter) JSON(dst interface{}) error {
+	data := []byte(f.Predicate)
+	if !json.Valid(data) {
+		if _, value, ok := f.Operator(); ok {
+			data = []byte(value)
+		}
+	}
+	if err := json.Unmarshal(data, dst); err != nil {
+		return fmt.Errorf("qparser: filter[%s]: %w", f.FieldName, err)
+	}
+	return nil
+}
+
+// checkOperators returns an error if a filter of the keyword uses an operator which is not in the known list
+// filters without an operator are accepted, empty known list accepts any operator
+// the part before the colon which is not an operator name e.g. "2020-01-01T10" of the predicate
+// "2020-01-01T10:00:00" is not checked, see isOperatorName
+func checkOperators(keyword string, filters []Filter, known []string) error {
+	for _, f := range filters {
+		op, _, ok := f.Operator()
+		if !ok || !isOperatorName(op) {
+			continue
+		}
+		if err := checkAllowed(valueKey(keyword, f.FieldName)+" operator", op, known); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isOperatorName reports whether the string looks like an operator i.e. it starts with a letter
+// followed by letters, digits, '_' or '-' e.g. "eq", "not_in" or "not-like"
+func isOperatorName(s string) bool {
+	for i, r := range s {
+		switch {
+		case unicode.IsLetter(r):
+		case i > 0 && (unicode.IsDigit(r) || r == '_' || r == '-'):
+		default:
+			return false
+		}
+	}
+	return s != ""
+}
+
+// checkFilterIncludes returns an error if a scoped filter e.g. 'filter[author.name]=eq:bob' refers to a relation
+// which is not included, the relation path is the part of the field name before the last dot
+func checkFilterIncludes(filters []Filter, includes []Include, opts *options) error {
+	var paths []string
+	for _, f := range filters {
+		i := strings.LastIndexByte(f.FieldName, nestedRelationDelimiter)
+		if i <= 0 {
+			continue
+		}
+		if paths == nil {
+			paths = includePaths(includes)
+		}
+		scope := f.FieldName[:i]
+		included := false
+		for _, path := range paths {
+			if opts.sameRelation(path, scope) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return wrapError(ErrInvalidValue, "qparser: filter[%s] requires the relation %q to be included", f.FieldName, scope)
+		}
+	}
+	return nil
+}
+
+// List splits the predicate value (the operator is skipped) into a list of elements, see SplitList
+// e.g. 'filter[name]=in:"a,b",c' results in []string{"a,b", "c"}
+func (f Filter) List() ([]string, error) {
+	_, value, _ := f.Operator()
+	list, err := SplitList(value)
+	if err != nil {
+		return nil, fmt.Errorf("qparser: filter[%s]: %w", f.FieldName, err)
+	}
+	return list, nil
+}
+
+// SplitList splits a comma separated list of elements, an element may be enclosed in double quotes
+// in order to contain commas, e.g. `"a,b",c,"d"` results in []string{"a,b", "c", "d"}
+// a double quote inside of a quoted element is escaped either by a backslash or by another double quote:
+// `"say \"hi\""` and `"say ""hi"""` both result in `say "hi"`, a backslash escapes a backslash as well
+// a double quote inside of an unquoted element is kept as is, empty elements are kept
+// an unterminated quoted element or characters after the closing quote result in an error
+// empty value results in nil
+func SplitList(value string) ([]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	list := make([]string, 0, strings.Count(value, string(listDelimiter))+1)
+	element := make([]byte, 0, len(value))
+	for i := 0; i <= len(value); i++ {
+		if i == len(value) || value[i] == listDelimiter {
+			list = append(list, string(element))
+			element = element[:0]
+			continue
+		}
+		if len(element) > 0 || value[i] != quoteChar {
+			element = append(element, value[i])
+			continue
+		}
+		// quoted element
+		closed := false
+		for i++; i < len(value); i++ {
+			c := value[i]
+			if c == escapeChar && i+1 < len(value) && (value[i+1] == quoteChar || value[i+1] == escapeChar) {
+				i++
+				element = append(element, value[i])
+				continue
+			}
+			if c == quoteChar {
+				if i+1 < len(value) && value[i+1] == quoteChar {
+					i++
+					element = append(element, quoteChar)
+					continue
+				}
+				closed = true
+				break
+			}
+			element = append(element, c)
+		}
+		if !closed {
+			return nil, fmt.Errorf("unterminated quoted element in %q", value)
+		}
+		if i+1 < len(value) && value[i+1] != listDelimiter {
+			return nil, fmt.Errorf("unexpected character %q after the closing quote at position %d in %q", value[i+1], i+1, value)
+		}
+		// the delimiter or the end is processed by the next iteration
+		if i+1 == len(value) {
+			list = append(list, string(element))
+			return list, nil
+		}
+		i++
+		list = append(list, string(element))
+		element = element[:0]
+	}
+	return list, nil
+}
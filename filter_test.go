@@ -0,0 +1,534 @@
+package qparser
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type filterTimeTest struct {
+	in      Filter
+	layouts []string
+	out     time.Time
+	err     bool
+}
+
+var filterTimeTests = []filterTimeTest{
+	{
+		in:  Filter{FieldName: "createdAt", Predicate: "gt:2020-01-02T15:04:05Z"},
+		out: time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC),
+	},
+	{
+		in:  Filter{FieldName: "createdAt", Predicate: "2020-01-02T15:04:05Z"},
+		out: time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC),
+	},
+	{
+		in:  Filter{FieldName: "createdAt", Predicate: "lt:2015-01-01"},
+		out: time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC),
+	},
+	{
+		in:      Filter{FieldName: "createdAt", Predicate: "eq:02.01.2015"},
+		layouts: []string{"02.01.2006"},
+		out:     time.Date(2015, 1, 2, 0, 0, 0, 0, time.UTC),
+	},
+	{
+		in:      Filter{FieldName: "createdAt", Predicate: "eq:2015-01-02"},
+		layouts: []string{"02.01.2006"},
+		err:     true,
+	},
+	{
+		in:  Filter{FieldName: "createdAt", Predicate: "gt:yesterday"},
+		err: true,
+	},
+	{
+		in:  Filter{FieldName: "createdAt", Predicate: ""},
+		err: true,
+	},
+}
+
+func TestFilterTime(t *testing.T) {
+	for _, tt := range filterTimeTests {
+		r, err := tt.in.Time(tt.layouts...)
+		if err != nil && !tt.err {
+			t.Errorf("Filter%+v.Time(%q) returned unexpected error %s", tt.in, tt.layouts, err)
+			continue
+		}
+		if err == nil && tt.err {
+			t.Errorf("expected Filter%+v.Time(%q) to return error, but nil is returned", tt.in, tt.layouts)
+			continue
+		}
+		if !r.Equal(tt.out) {
+			t.Errorf("Filter%+v.Time(%q):\n\tgot  %v\n\twant %v\n", tt.in, tt.layouts, r, tt.out)
+		}
+	}
+}
+
+func TestQueryUnparsedFilters(t *testing.T) {
+	const query = "filter[title]=eq:foo&filter=bar&filter[price][gte]=10&filter[tag]="
+	q, err := ParseQuery(query)
+	if err != nil {
+		t.Fatalf("ParseQuery(%q) returned error %v", query, err)
+	}
+	expected := []Value{
+		{TopLevelKey: "filter", Value: "bar"},
+		{TopLevelKey: "filter", NestedKeys: []string{"price", "gte"}, Value: "10"},
+	}
+	if got := q.UnparsedFilters(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("UnparsedFilters() of %q:\n\tgot  %+v\n\twant %+v\n", query, got, expected)
+	}
+	expectedFilters := []Filter{{FieldName: "title", Predicate: "eq:foo", Op: "eq", Value: "foo"}}
+	if !reflect.DeepEqual(q.Filters, expectedFilters) {
+		t.Errorf("Filters of %q:\n\tgot  %+v\n\twant %+v\n", query, q.Filters, expectedFilters)
+	}
+
+	var nilQuery *Query
+	if got := nilQuery.UnparsedFilters(); got != nil {
+		t.Errorf("UnparsedFilters() of nil query returned %+v, want nil", got)
+	}
+}
+
+func TestQueryUnparsedFiltersOperatorInKey(t *testing.T) {
+	const query = "filter[title]=eq:foo&filter=bar&filter[price][gte]=10&filter[a][b][c]=1"
+	q, err := NewParser(WithOperatorInKey(true)).ParseQuery(query)
+	if err != nil {
+		t.Fatalf("ParseQuery(%q) returned error %v", query, err)
+	}
+	expected := []Value{
+		{TopLevelKey: "filter", Value: "bar"},
+		{TopLevelKey: "filter", NestedKeys: []string{"a", "b", "c"}, Value: "1"},
+	}
+	if got := q.UnparsedFilters(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("UnparsedFilters() of %q:\n\tgot  %+v\n\twant %+v\n", query, got, expected)
+	}
+	expectedFilters := []Filter{
+		{FieldName: "title", Predicate: "eq:foo", Op: "eq", Value: "foo"},
+		{FieldName: "price", Predicate: "gte:10", Op: "gte", Value: "10"},
+	}
+	if !reflect.DeepEqual(q.Filters, expectedFilters) {
+		t.Errorf("Filters of %q:\n\tgot  %+v\n\twant %+v\n", query, q.Filters, expectedFilters)
+	}
+}
+
+type rangeForTest struct {
+	in    string
+	field string
+	lo    string
+	hi    string
+	ok    bool
+}
+
+var rangeForTests = []rangeForTest{
+	{in: "filter[price][gte]=10&filter[price][lte]=100", field: "price", lo: "10", hi: "100", ok: true},
+	{in: "filter[price][gt]=10&filter[price][lt]=100", field: "price", lo: "10", hi: "100", ok: true},
+	{in: "filter[price]=gte:10&filter[price]=lte:100", field: "price", lo: "10", hi: "100", ok: true},
+	{in: "filter[price][lte]=100&filter[price][gte]=10", field: "price", lo: "10", hi: "100", ok: true},
+	{in: "filter[price][gte]=10", field: "price", lo: "10", ok: true},
+	{in: "filter[price][lte]=100", field: "price", hi: "100", ok: true},
+	{in: "filter[price]=between:10,100", field: "price", lo: "10", hi: "100", ok: true},
+	{in: "filter[price][gte]=10&filter[price][gte]=20", field: "price", lo: "20", ok: true},
+	{in: "filter[price][gte]=10&filter[cost][lte]=100", field: "cost", hi: "100", ok: true},
+	{in: "filter[price][eq]=10", field: "price"},
+	{in: "filter[price]=10", field: "price"},
+	{in: "filter[price][gte]=10", field: "cost"},
+	{in: "", field: "price"},
+}
+
+func TestQueryRangeFor(t *testing.T) {
+	p := NewParser(WithOperatorInKey(true))
+	for _, tt := range rangeForTests {
+		q, err := p.ParseQuery(tt.in)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) returned error %v", tt.in, err)
+			continue
+		}
+		lo, hi, ok := q.RangeFor(tt.field)
+		if lo != tt.lo || hi != tt.hi || ok != tt.ok {
+			t.Errorf(
+				"RangeFor(%q) of %q returned %q, %q, %t; want %q, %q, %t",
+				tt.field, tt.in, lo, hi, ok, tt.lo, tt.hi, tt.ok,
+			)
+		}
+	}
+	var nilQuery *Query
+	if lo, hi, ok := nilQuery.RangeFor("price"); lo != "" || hi != "" || ok {
+		t.Errorf("RangeFor() of nil query returned %q, %q, %t; want empty", lo, hi, ok)
+	}
+}
+
+type filterOperatorTest struct {
+	in       string
+	outOp    string
+	outValue string
+	outOk    bool
+}
+
+var filterOperatorTests = []filterOperatorTest{
+	{in: "lt:2020-01-02", outOp: "lt", outValue: "2020-01-02", outOk: true},
+	{in: "eq:", outOp: "eq", outValue: "", outOk: true},
+	{in: "like:a:b:c", outOp: "like", outValue: "a:b:c", outOk: true},
+	{in: "foo", outOp: "", outValue: "foo", outOk: false},
+	{in: ":foo", outOp: "", outValue: "foo", outOk: true},
+}
+
+func TestFilterOperator(t *testing.T) {
+	for _, tt := range filterOperatorTests {
+		f := Filter{FieldName: "field", Predicate: tt.in}
+		op, value, ok := f.Operator()
+		if op != tt.outOp || value != tt.outValue || ok != tt.outOk {
+			t.Errorf(
+				"Filter{Predicate: %q}.Operator() returned %q, %q, %t; want %q, %q, %t",
+				tt.in,
+				op,
+				value,
+				ok,
+				tt.outOp,
+				tt.outValue,
+				tt.outOk,
+			)
+		}
+
+		query := "filter[field]=" + url.QueryEscape(tt.in)
+		q, err := ParseQuery(query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) returned error %v", query, err)
+			continue
+		}
+		expected := []Filter{{FieldName: "field", Predicate: tt.in, Op: tt.outOp, Value: tt.outValue}}
+		if !reflect.DeepEqual(q.Filters, expected) {
+			t.Errorf("Filters of %q:\n\tgot  %+v\n\twant %+v\n", query, q.Filters, expected)
+		}
+	}
+}
+
+type filterFieldRefTest struct {
+	in  string
+	ref string
+	ok  bool
+}
+
+var filterFieldRefTests = []filterFieldRefTest{
+	{in: "lt:field:endDate", ref: "endDate", ok: true},
+	{in: "eq:field:author.id", ref: "author.id", ok: true},
+	{in: "lt:2020-01-02"},
+	{in: "eq:field"},
+	{in: "eq:field:"},
+	{in: "field:endDate"},
+	{in: "eq:fields:endDate"},
+	{in: ""},
+}
+
+func TestFilterFieldRef(t *testing.T) {
+	for _, tt := range filterFieldRefTests {
+		f := Filter{FieldName: "startDate", Predicate: tt.in}
+		if ref, ok := f.FieldRef(); ref != tt.ref || ok != tt.ok {
+			t.Errorf("FieldRef() of %q returned %q, %t; want %q, %t", tt.in, ref, ok, tt.ref, tt.ok)
+		}
+	}
+}
+
+type filterTypeHintTest struct {
+	in  string
+	typ string
+	ok  bool
+}
+
+var filterTypeHintTests = []filterTypeHintTest{
+	{in: "gt:int:18", typ: "int", ok: true},
+	{in: "eq:bool:true", typ: "bool", ok: true},
+	{in: "lt:time:2020-01-02T15:04:05Z", typ: "time", ok: true},
+	{in: "eq:string:", typ: "string", ok: true},
+	{in: "gt:18"},
+	{in: "like:a:b"},
+	{in: "eq:INT:18"},
+	{in: "int:18"},
+	{in: "eq:field:endDate"},
+	{in: "plain"},
+	{in: ""},
+}
+
+func TestFilterTypeHint(t *testing.T) {
+	for _, tt := range filterTypeHintTests {
+		f := Filter{FieldName: "age", Predicate: tt.in}
+		if typ, ok := f.TypeHint(); typ != tt.typ || ok != tt.ok {
+			t.Errorf("TypeHint() of %q returned %q, %t; want %q, %t", tt.in, typ, ok, tt.typ, tt.ok)
+		}
+	}
+}
+
+type usedOperatorsTest struct {
+	in  string
+	out []string
+}
+
+var usedOperatorsTests = []usedOperatorsTest{
+	{in: "", out: nil},
+	{
+		in:  "filter[title]=like:foo&filter[createdAt]=lt:2020-01-02&filter[author]=eq:bob&filter[tag]=eq:go&filter[name]=plain&filter[price]=lt:10",
+		out: []string{"like", "lt", "eq"},
+	},
+	{in: "filter[createdAt]=2020-01-01T10:00:00Z&filter[at]=10:30", out: nil},
+	{in: "filter[createdAt]=2020-01-01T10:00:00Z&filter[site]=eq:https://example.com", out: []string{"eq"}},
+}
+
+func TestQueryUsedOperators(t *testing.T) {
+	for _, tt := range usedOperatorsTests {
+		q, err := ParseQuery(tt.in)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q) returned error %v", tt.in, err)
+		}
+		if got := q.UsedOperators(); !reflect.DeepEqual(got, tt.out) {
+			t.Errorf("UsedOperators() of %q:\n\tgot  %+v\n\twant %+v\n", tt.in, got, tt.out)
+		}
+	}
+
+	var nilQuery *Query
+	if got := nilQuery.UsedOperators(); got != nil {
+		t.Errorf("UsedOperators() of nil query returned %+v, want nil", got)
+	}
+}
+
+func TestQueryFiltersByField(t *testing.T) {
+	const query = "filter[title]=like:foo&filter[author.name]=eq:bob&filter[createdAt]=lt:2020-01-02&filter[title]=ne:bar&filter[author.age]=gt:30"
+	q, err := ParseQuery(query)
+	if err != nil {
+		t.Fatalf("ParseQuery(%q) returned error %v", query, err)
+	}
+	expected := map[string][]Filter{
+		"title":       {{FieldName: "title", Predicate: "like:foo", Op: "like", Value: "foo"}, {FieldName: "title", Predicate: "ne:bar", Op: "ne", Value: "bar"}},
+		"author.name": {{FieldName: "author.name", Predicate: "eq:bob", Op: "eq", Value: "bob"}},
+		"createdAt":   {{FieldName: "createdAt", Predicate: "lt:2020-01-02", Op: "lt", Value: "2020-01-02"}},
+		"author.age":  {{FieldName: "author.age", Predicate: "gt:30", Op: "gt", Value: "30"}},
+	}
+	if got := q.FiltersByField(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("FiltersByField() of %q:\n\tgot  %+v\n\twant %+v\n", query, got, expected)
+	}
+	// the order must be stable across calls
+	for i := 0; i < 10; i++ {
+		expectedFields := []string{"title", "author.name", "createdAt", "author.age"}
+		if got := q.FilterFields(); !reflect.DeepEqual(got, expectedFields) {
+			t.Fatalf("FilterFields() of %q:\n\tgot  %+v\n\twant %+v\n", query, got, expectedFields)
+		}
+	}
+	expectedScoped := []Filter{{FieldName: "name", Predicate: "eq:bob", Op: "eq", Value: "bob"}, {FieldName: "age", Predicate: "gt:30", Op: "gt", Value: "30"}}
+	if got := q.ScopedFilters("author"); !reflect.DeepEqual(got, expectedScoped) {
+		t.Errorf("ScopedFilters(%q) of %q:\n\tgot  %+v\n\twant %+v\n", "author", query, got, expectedScoped)
+	}
+	if got := q.ScopedFilters("comments"); got != nil {
+		t.Errorf("ScopedFilters(%q) of %q returned %+v, want nil", "comments", query, got)
+	}
+
+	var nilQuery *Query
+	if nilQuery.FiltersByField() != nil || nilQuery.FilterFields() != nil || nilQuery.ScopedFilters("a") != nil {
+		t.Errorf("filter accessors of nil query must return nil")
+	}
+}
+
+func TestQueryFilterGroups(t *testing.T) {
+	const query = "filter[status]=eq:a&filter[type]=eq:c&filter[status]=eq:b"
+	q, err := ParseQuery(query)
+	if err != nil {
+		t.Fatalf("ParseQuery(%q) returned error %v", query, err)
+	}
+	expected := []FilterGroup{
+		{
+			FieldName: "status",
+			Filters:   []Filter{{FieldName: "status", Predicate: "eq:a", Op: "eq", Value: "a"}, {FieldName: "status", Predicate: "eq:b", Op: "eq", Value: "b"}},
+		},
+		{
+			FieldName: "type",
+			Filters:   []Filter{{FieldName: "type", Predicate: "eq:c", Op: "eq", Value: "c"}},
+		},
+	}
+	if got := q.FilterGroups(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("FilterGroups() of %q:\n\tgot  %+v\n\twant %+v\n", query, got, expected)
+	}
+
+	var nilQuery *Query
+	if got := nilQuery.FilterGroups(); got != nil {
+		t.Errorf("FilterGroups() of nil query returned %+v, want nil", got)
+	}
+}
+
+func TestQueryFilterMap(t *testing.T) {
+	const query = "filter[title]=like:foo&filter[createdAt]=lt:2020-01-02&filter[title]=ne:bar"
+	q, err := ParseQuery(query)
+	if err != nil {
+		t.Fatalf("ParseQuery(%q) returned error %v", query, err)
+	}
+	expected := map[string][]string{
+		"title":     {"like:foo", "ne:bar"},
+		"createdAt": {"lt:2020-01-02"},
+	}
+	m := q.FilterMap()
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("FilterMap() of %q:\n\tgot  %+v\n\twant %+v\n", query, m, expected)
+	}
+	q.Filters = append(q.Filters, Filter{FieldName: "tag", Predicate: "eq:go"})
+	if _, ok := m["tag"]; ok {
+		t.Errorf("FilterMap() must return a snapshot which is not affected by the later changes")
+	}
+
+	var nilQuery *Query
+	if m := nilQuery.FilterMap(); m != nil {
+		t.Errorf("FilterMap() of nil query returned %+v, want nil", m)
+	}
+}
+
+type numberWithUnitTest struct {
+	in   string
+	num  float64
+	unit string
+	err  bool
+}
+
+var numberWithUnitTests = []numberWithUnitTest{
+	{in: "gt:10MB", num: 10, unit: "MB"},
+	{in: "lt:1.5h", num: 1.5, unit: "h"},
+	{in: "eq:-3 kg", num: -3, unit: "kg"},
+	{in: "100", num: 100, unit: ""},
+	{in: "gte:2.5e3", num: 2500, unit: ""},
+	{in: "lt:5µs", num: 5, unit: "µs"},
+	{in: "gt:MB", err: true},
+	{in: "gt:", err: true},
+	{in: "gt:10MB5", err: true},
+	{in: "Inf", err: true},
+}
+
+func TestFilterNumberWithUnit(t *testing.T) {
+	for _, tt := range numberWithUnitTests {
+		f := Filter{FieldName: "size", Predicate: tt.in}
+		num, unit, err := f.NumberWithUnit()
+		if err != nil && !tt.err {
+			t.Errorf("NumberWithUnit() of %q returned unexpected error %s", tt.in, err)
+			continue
+		}
+		if err == nil && tt.err {
+			t.Errorf("expected NumberWithUnit() of %q to return error, but nil is returned", tt.in)
+			continue
+		}
+		if num != tt.num || unit != tt.unit {
+			t.Errorf("NumberWithUnit() of %q returned %v, %q; want %v, %q", tt.in, num, unit, tt.num, tt.unit)
+		}
+	}
+}
+
+type filterJSONTest struct {
+	in  string
+	out interface{}
+	err bool
+}
+
+var filterJSONTests = []filterJSONTest{
+	{in: `{"lat":1,"lng":2}`, out: map[string]interface{}{"lat": 1.0, "lng": 2.0}},
+	{in: `near:{"lat":1,"lng":2}`, out: map[string]interface{}{"lat": 1.0, "lng": 2.0}},
+	{in: `in:[1,2,3]`, out: []interface{}{1.0, 2.0, 3.0}},
+	{in: `"a:b"`, out: "a:b"},
+	{in: `eq:"a:b"`, out: "a:b"},
+	{in: `42`, out: 42.0},
+	{in: `{"lat":`, err: true},
+	{in: `near:{lat}`, err: true},
+	{in: ``, err: true},
+}
+
+func TestFilterJSON(t *testing.T) {
+	for _, tt := range filterJSONTests {
+		f := Filter{FieldName: "geo", Predicate: tt.in}
+		var r interface{}
+		err := f.JSON(&r)
+		if err != nil && !tt.err {
+			t.Errorf("JSON() of %q returned unexpected error %s", tt.in, err)
+			continue
+		}
+		if err == nil && tt.err {
+			t.Errorf("expected JSON() of %q to return error, but nil is returned", tt.in)
+			continue
+		}
+		if err != nil {
+			var syntaxErr *json.SyntaxError
+			if !strings.HasPrefix(err.Error(), "qparser: filter[geo]: ") || !errors.As(err, &syntaxErr) {
+				t.Errorf("JSON() of %q returned error %q, want wrapped *json.SyntaxError", tt.in, err)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(r, tt.out) {
+			t.Errorf("JSON() of %q:\n\tgot  %+v\n\twant %+v\n", tt.in, r, tt.out)
+		}
+	}
+
+	var point struct {
+		Lat float64 `json:"lat"`
+		Lng float64 `json:"lng"`
+	}
+	q, _ := ParseQuery(`filter[geo]=near:%7B%22lat%22:53.9,%22lng%22:27.56%7D`)
+	if err := q.Filters[0].JSON(&point); err != nil || point.Lat != 53.9 || point.Lng != 27.56 {
+		t.Errorf("JSON() of %q returned %v and %+v", q.Filters[0].Predicate, err, point)
+	}
+}
+
+type splitListTest struct {
+	in  string
+	out []string
+	err bool
+}
+
+var splitListTests = []splitListTest{
+	{in: "", out: nil},
+	{in: "a", out: []string{"a"}},
+	{in: "a,b,c", out: []string{"a", "b", "c"}},
+	{in: `"a,b",c,"d"`, out: []string{"a,b", "c", "d"}},
+	{in: `"a,b"`, out: []string{"a,b"}},
+	{in: `a,,b,`, out: []string{"a", "", "b", ""}},
+	{in: `"",""`, out: []string{"", ""}},
+	{in: `"a",`, out: []string{"a", ""}},
+	{in: `"say \"hi\""`, out: []string{`say "hi"`}},
+	{in: `"say ""hi""",x`, out: []string{`say "hi"`, "x"}},
+	{in: `"back\\slash"`, out: []string{`back\slash`}},
+	{in: `"back\slash"`, out: []string{`back\slash`}},
+	{in: `5" screen,a"b`, out: []string{`5" screen`, `a"b`}},
+	{in: `"ッ,😀",é`, out: []string{"ッ,😀", "é"}},
+	{in: `"unterminated,a`, err: true},
+	{in: `"a"b,c`, err: true},
+	{in: `"a\"`, err: true},
+}
+
+func TestSplitList(t *testing.T) {
+	for _, tt := range splitListTests {
+		r, err := SplitList(tt.in)
+		if err != nil && !tt.err {
+			t.Errorf("SplitList(%q) returned unexpected error %s", tt.in, err)
+			continue
+		}
+		if err == nil && tt.err {
+			t.Errorf("expected SplitList(%q) to return error, but nil is returned", tt.in)
+			continue
+		}
+		if !reflect.DeepEqual(r, tt.out) {
+			t.Errorf("SplitList(%q):\n\tgot  %q\n\twant %q\n", tt.in, r, tt.out)
+		}
+	}
+}
+
+func TestFilterList(t *testing.T) {
+	const query = `filter[name]=in:"a,b",c,"d"`
+	q, err := ParseQuery(query)
+	if err != nil {
+		t.Fatalf("ParseQuery(%q) returned error %v", query, err)
+	}
+	list, err := q.Filters[0].List()
+	if err != nil {
+		t.Fatalf("Filter.List() of %q returned error %v", query, err)
+	}
+	expected := []string{"a,b", "c", "d"}
+	if !reflect.DeepEqual(list, expected) {
+		t.Errorf("Filter.List() of %q:\n\tgot  %q\n\twant %q\n", query, list, expected)
+	}
+
+	f := Filter{FieldName: "name", Predicate: `in:"a,b`}
+	if _, err := f.List(); err == nil || !strings.Contains(err.Error(), "filter[name]") {
+		t.Errorf("Filter%+v.List() returned error %v, want error mentioning the field", f, err)
+	}
+}
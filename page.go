@@ -0,0 +1,134 @@
+package qparser
+
+import (
+	"errors"
+	"strconv"
+)
+
+const (
+	unboundedPageSize = "all"
+	maxInt            = int(^uint(0) >> 1)
+)
+
+// IsUnbounded reports whether all records are requested e.g. "page[size]=all"
+// the sentinel value is configured by WithUnboundedPageSize, the flag is set by the parser
+func (p *Page) IsUnbounded() bool {
+	return p != nil && p.unbounded
+}
+
+// IsCountOnly reports whether the page size is explicitly zero e.g. "page[size]=0", which requests the count
+// and the other metadata without the records, so the handler may skip fetching them, an absent or invalid size is not
+func (p *Page) IsCountOnly() bool {
+	if p == nil || p.Size == "" {
+		return false
+	}
+	size, err := p.SizeInt()
+	return err == nil && size == 0
+}
+
+// SizeInt returns the page size as an integer, see parsePageInt for the accepted format
+// the integer accessors reject values greater than the bound set by WithMaxPageValue
+func (p *Page) SizeInt() (int, error) {
+	if p == nil {
+		return 0, nil
+	}
+	return parsePageInt("size", p.Size, p.maxValue)
+}
+
+// SizeIntOr returns the page size as an integer or the default if the size is unset or invalid,
+// e.g. SizeIntOr(20) of "page[size]=ten" results in 20, see SizeInt for the accepted format
+func (p *Page) SizeIntOr(def int) int {
+	if p == nil || p.Size == "" {
+		return def
+	}
+	size, err := p.SizeInt()
+	if err != nil {
+		return def
+	}
+	return size
+}
+
+// NumberInt returns the page number as an integer, see parsePageInt for the accepted format
+func (p *Page) NumberInt() (int, error) {
+	if p == nil {
+		return 0, nil
+	}
+	return parsePageInt("number", p.Number, p.maxValue)
+}
+
+// LimitInt returns the page limit as an integer, see parsePageInt for the accepted format
+func (p *Page) LimitInt() (int, error) {
+	if p == nil {
+		return 0, nil
+	}
+	return parsePageInt("limit", p.Limit, p.maxValue)
+}
+
+// OffsetInt returns the page offset as an integer, see parsePageInt for the accepted format
+func (p *Page) OffsetInt() (int, error) {
+	if p == nil {
+		return 0, nil
+	}
+	return parsePageInt("offset", p.Offset, p.maxValue)
+}
+
+// EffectiveOffset returns the offset of the first record of the page, the explicit page[offset] is returned if it is set,
+// otherwise the offset is computed from page[number] and page[size] as (number-1)*size,
+// the number starts from 1, zero is returned if neither the offset nor the number is set
+func (p *Page) EffectiveOffset() (int, error) {
+	if p == nil {
+		return 0, nil
+	}
+	if p.Offset != "" {
+		return p.OffsetInt()
+	}
+	number, err := p.NumberInt()
+	if err != nil || p.Number == "" {
+		return 0, err
+	}
+	if number < 1 {
+		return 0, wrapError(ErrInvalidValue, "qparser: page[number] %q must be greater than 0", p.Number)
+	}
+	if p.Size == "" {
+		return 0, wrapError(ErrInvalidValue, "qparser: page[size] is required to compute the offset of page[number]")
+	}
+	size, err := p.SizeInt()
+	if err != nil {
+		return 0, err
+	}
+	if size > 0 && number-1 > maxInt/size {
+		return 0, wrapError(ErrInvalidValue, "qparser: offset of page[number] %q and page[size] %q overflows", p.Number, p.Size)
+	}
+	offset := (number - 1) * size
+	if p.maxValue > 0 && offset > p.maxValue {
+		return 0, wrapError(ErrInvalidValue, "qparser: offset of page[number] %q and page[size] %q exceeds the maximum %d", p.Number, p.Size, p.maxValue)
+	}
+	return offset, nil
+}
+
+// parsePageInt strictly parses the value of the page parameter
+// only a non-empty sequence of ASCII digits is accepted, e.g. "10", "007"
+// signs, whitespace, thousands separators, decimal points and exponents ("-1", "+1", "1.000", "1,000", "1e3")
+// are rejected, empty value is treated as unset and results in 0 without an error
+// the value which does not fit into int or exceeds the positive max results in an error
+func parsePageInt(name, value string, max int) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	for i := 0; i < len(value); i++ {
+		if value[i] < '0' || value[i] > '9' {
+			return 0, wrapError(ErrInvalidValue, "qparser: page[%s] %q is not an integer", name, value)
+		}
+	}
+	n, err := strconv.ParseInt(value, 10, strconv.IntSize)
+	if err != nil {
+		if errors.Is(err, strconv.ErrRange) {
+			return 0, wrapError(ErrInvalidValue, "qparser: page[%s] %q is out of range, the maximum is %d", name, value, maxInt)
+		}
+		return 0, wrapError(ErrInvalidValue, "qparser: page[%s] %q is not an integer", name, value)
+	}
+	if max > 0 && n > int64(max) {
+		return 0, wrapError(ErrInvalidValue, "qparser: page[%s] %q exceeds the maximum %d", name, value, max)
+	}
+	return int(n), nil
+}
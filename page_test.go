@@ -0,0 +1,297 @@
+package qparser
+
+import (
+	"testing"
+)
+
+type pageIntTest struct {
+	in  string
+	out int
+	err bool
+}
+
+var pageIntTests = []pageIntTest{
+	{in: "", out: 0},
+	{in: "0", out: 0},
+	{in: "10", out: 10},
+	{in: "007", out: 7},
+	{in: "1.000", err: true},
+	{in: "1,000", err: true},
+	{in: "1e3", err: true},
+	{in: "1_000", err: true},
+	{in: "-1", err: true},
+	{in: "+1", err: true},
+	{in: " 1", err: true},
+	{in: "0x10", err: true},
+	{in: "ten", err: true},
+	{in: "99999999999999999999", err: true},
+	{in: "18446744073709551616", err: true},
+}
+
+func TestPageInt(t *testing.T) {
+	for _, tt := range pageIntTests {
+		page := &Page{Size: tt.in, Number: tt.in, Limit: tt.in, Offset: tt.in}
+		accessors := map[string]func() (int, error){
+			"SizeInt":   page.SizeInt,
+			"NumberInt": page.NumberInt,
+			"LimitInt":  page.LimitInt,
+			"OffsetInt": page.OffsetInt,
+		}
+		for name, accessor := range accessors {
+			n, err := accessor()
+			if err != nil && !tt.err {
+				t.Errorf("Page.%s() of %q returned unexpected error %s", name, tt.in, err)
+				continue
+			}
+			if err == nil && tt.err {
+				t.Errorf("expected Page.%s() of %q to return error, but nil is returned", name, tt.in)
+				continue
+			}
+			if n != tt.out {
+				t.Errorf("Page.%s() of %q returned %d, want %d", name, tt.in, n, tt.out)
+			}
+		}
+	}
+}
+
+func TestPageIntNil(t *testing.T) {
+	var page *Page
+	if n, err := page.SizeInt(); n != 0 || err != nil {
+		t.Errorf("Page.SizeInt() of nil page returned %d, %v; want 0, nil", n, err)
+	}
+}
+
+type pageSizeIntOrTest struct {
+	in  *Page
+	out int
+}
+
+var pageSizeIntOrTests = []pageSizeIntOrTest{
+	{in: nil, out: 20},
+	{in: &Page{}, out: 20},
+	{in: &Page{Number: "2"}, out: 20},
+	{in: &Page{Size: "0"}, out: 0},
+	{in: &Page{Size: "10"}, out: 10},
+	{in: &Page{Size: "ten"}, out: 20},
+	{in: &Page{Size: "-1"}, out: 20},
+	{in: &Page{Size: "101", maxValue: 100}, out: 20},
+}
+
+func TestPageSizeIntOr(t *testing.T) {
+	for _, tt := range pageSizeIntOrTests {
+		if n := tt.in.SizeIntOr(20); n != tt.out {
+			t.Errorf("SizeIntOr(20) of %+v returned %d, want %d", tt.in, n, tt.out)
+		}
+	}
+}
+
+type maxPageValueTest struct {
+	in     string
+	max    int
+	number int
+	size   int
+	err    bool
+}
+
+var maxPageValueTests = []maxPageValueTest{
+	{in: "page[number]=1000&page[size]=100", max: 0, number: 1000, size: 100},
+	{in: "page[number]=1000&page[size]=100", max: 1000, number: 1000, size: 100},
+	{in: "page[number]=1001&page[size]=100", max: 1000, err: true},
+	{in: "page[number]=99999999999999999999&page[size]=100", max: 1000, err: true},
+	{in: "page[number]=99999999999999999999&page[size]=100", max: -1, err: true},
+}
+
+func TestPageMaxValue(t *testing.T) {
+	for _, tt := range maxPageValueTests {
+		q, err := NewParser(WithMaxPageValue(tt.max)).ParseQuery(tt.in)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) returned error %v", tt.in, err)
+			continue
+		}
+		number, err := q.Page.NumberInt()
+		if (err != nil) != tt.err {
+			t.Errorf("Page.NumberInt() of %q with the maximum %d returned error %v, want error %t", tt.in, tt.max, err, tt.err)
+			continue
+		}
+		size, _ := q.Page.SizeInt()
+		if !tt.err && (number != tt.number || size != tt.size) {
+			t.Errorf("Page of %q returned %d, %d; want %d, %d", tt.in, number, size, tt.number, tt.size)
+		}
+	}
+}
+
+type pageUnboundedTest struct {
+	in   string
+	opts []Option
+	out  bool
+}
+
+var pageUnboundedTests = []pageUnboundedTest{
+	{in: "", out: false},
+	{in: "page[number]=1", out: false},
+	{in: "page[size]=10", out: false},
+	{in: "page[size]=all", out: true},
+	{in: "page[size]=ALL", out: false},
+	{in: "page[size]=all", opts: []Option{WithUnboundedPageSize("")}, out: false},
+	{in: "page[size]=-1", opts: []Option{WithUnboundedPageSize("-1")}, out: true},
+	{in: "page[size]=all", opts: []Option{WithUnboundedPageSize("-1")}, out: false},
+}
+
+func TestPageIsUnbounded(t *testing.T) {
+	for _, tt := range pageUnboundedTests {
+		q, err := NewParser(tt.opts...).ParseQuery(tt.in)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) returned error %v", tt.in, err)
+			continue
+		}
+		if r := q.Page.IsUnbounded(); r != tt.out {
+			t.Errorf("Page.IsUnbounded() of %q returned %t, want %t", tt.in, r, tt.out)
+		}
+	}
+}
+
+type pageCountOnlyTest struct {
+	in  string
+	out bool
+}
+
+var pageCountOnlyTests = []pageCountOnlyTest{
+	{in: "", out: false},
+	{in: "page[number]=1", out: false},
+	{in: "page[size]=", out: false},
+	{in: "page[size]=0", out: true},
+	{in: "page[size]=000", out: true},
+	{in: "page[size]=10", out: false},
+	{in: "page[size]=-0", out: false},
+	{in: "page[size]=all", out: false},
+	{in: "page[limit]=0", out: false},
+}
+
+func TestPageIsCountOnly(t *testing.T) {
+	for _, tt := range pageCountOnlyTests {
+		q, err := ParseQuery(tt.in)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) returned error %v", tt.in, err)
+			continue
+		}
+		if r := q.Page.IsCountOnly(); r != tt.out {
+			t.Errorf("Page.IsCountOnly() of %q returned %t, want %t", tt.in, r, tt.out)
+		}
+	}
+}
+
+type effectiveOffsetTest struct {
+	in  *Page
+	out int
+	err bool
+}
+
+var effectiveOffsetTests = []effectiveOffsetTest{
+	{in: nil, out: 0},
+	{in: &Page{}, out: 0},
+	{in: &Page{Size: "10"}, out: 0},
+	{in: &Page{Number: "1", Size: "10"}, out: 0},
+	{in: &Page{Number: "3", Size: "10"}, out: 20},
+	{in: &Page{Number: "3", Size: "0"}, out: 0},
+	{in: &Page{Offset: "15", Number: "3", Size: "10"}, out: 15},
+	{in: &Page{Offset: "0", Number: "3", Size: "10"}, out: 0},
+	{in: &Page{Offset: "-1"}, err: true},
+	{in: &Page{Number: "0", Size: "10"}, err: true},
+	{in: &Page{Number: "-2", Size: "10"}, err: true},
+	{in: &Page{Number: "2"}, err: true},
+	{in: &Page{Number: "2", Size: "ten"}, err: true},
+	{in: &Page{Number: "9223372036854775807", Size: "10"}, err: true},
+	{in: &Page{Number: "99999999999999999999", Size: "10"}, err: true},
+	{in: &Page{Number: "3", Size: "10", maxValue: 20}, out: 20},
+	{in: &Page{Number: "4", Size: "10", maxValue: 20}, err: true},
+	{in: &Page{Offset: "21", maxValue: 20}, err: true},
+}
+
+func TestPageEffectiveOffset(t *testing.T) {
+	for _, tt := range effectiveOffsetTests {
+		n, err := tt.in.EffectiveOffset()
+		if err != nil && !tt.err {
+			t.Errorf("EffectiveOffset() of %+v returned unexpected error %s", tt.in, err)
+			continue
+		}
+		if err == nil && tt.err {
+			t.Errorf("expected EffectiveOffset() of %+v to return error, but nil is returned", tt.in)
+			continue
+		}
+		if n != tt.out {
+			t.Errorf("EffectiveOffset() of %+v returned %d, want %d", tt.in, n, tt.out)
+		}
+	}
+}
+
+type pageCursorTest struct {
+	in  string
+	out string
+}
+
+var pageCursorTests = []pageCursorTest{
+	{in: "page[cursor]=YWJjZA==", out: "YWJjZA=="},
+	{in: "page[cursor]=YWJjZA%3D%3D", out: "YWJjZA=="},
+	{in: "page[cursor]=YWJjZA=%3D&page[size]=10", out: "YWJjZA=="},
+	{in: "page[size]=10&page[cursor]=YWI=", out: "YWI="},
+	{in: "page[cursor]===", out: "=="},
+}
+
+func TestPageCursorPadding(t *testing.T) {
+	for _, tt := range pageCursorTests {
+		q, err := ParseQuery(tt.in)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) returned unexpected error %s", tt.in, err)
+			continue
+		}
+		if q.Page == nil || q.Page.Cursor != tt.out {
+			t.Errorf("ParseQuery(%q):\n\tgot  %+v\n\twant cursor %q\n", tt.in, q.Page, tt.out)
+		}
+	}
+}
+
+type pageCursorDirectionTest struct {
+	in     string
+	strict bool
+	out    *Page
+	err    bool
+}
+
+var pageCursorDirectionTests = []pageCursorDirectionTest{
+	{in: "page[cursor]=YWI=&page[direction]=next", out: &Page{Cursor: "YWI=", CursorDirection: CursorNext}},
+	{in: "page[cursor]=YWI=&page[direction]=prev", out: &Page{Cursor: "YWI=", CursorDirection: CursorPrev}},
+	{in: "page[cursor]=YWI=&page[direction]=PREV", strict: true, out: &Page{Cursor: "YWI=", CursorDirection: CursorPrev}},
+	{in: "page[cursor]=YWI=&page[direction]=", strict: true, out: &Page{Cursor: "YWI="}},
+	{in: "page[cursor]=YWI=", strict: true, out: &Page{Cursor: "YWI="}},
+	{in: "page[cursor]=YWI=&page[direction]=back", out: &Page{Cursor: "YWI="}},
+	{in: "page[cursor]=YWI=&page[direction]=back", strict: true, err: true},
+	{in: "page[direction]=sideways", out: nil},
+	{in: "page[direction]=", strict: true, out: nil},
+	{in: "page[direction]=next", out: &Page{CursorDirection: CursorNext}},
+}
+
+func TestPageCursorDirection(t *testing.T) {
+	for _, tt := range pageCursorDirectionTests {
+		q, err := NewParser(WithStrict(tt.strict)).ParseQuery(tt.in)
+		if err != nil && !tt.err {
+			t.Errorf("ParseQuery(%q) returned unexpected error %s", tt.in, err)
+			continue
+		}
+		if err == nil && tt.err {
+			t.Errorf("expected ParseQuery(%q) to return error, but nil is returned", tt.in)
+			continue
+		}
+		if tt.err {
+			continue
+		}
+		if tt.out == nil {
+			if q.Page != nil {
+				t.Errorf("ParseQuery(%q) returned page %+v, want nil", tt.in, q.Page)
+			}
+			continue
+		}
+		if q.Page == nil || q.Page.Cursor != tt.out.Cursor || q.Page.CursorDirection != tt.out.CursorDirection {
+			t.Errorf("ParseQuery(%q):\n\tgot  %+v\n\twant %+v\n", tt.in, q.Page, tt.out)
+		}
+	}
+}
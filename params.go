@@ -0,0 +1,242 @@
+package qparser
+
+import (
+	"regexp"
+	"strings"
+)
+
+// languageTagPattern matches the well-formed BCP 47 language tags, the case is not significant
+// language[-extlang][-script][-region][-variant...][-extension...][-privateuse] or a private use tag
+var languageTagPattern = regexp.MustCompile(
+	`^(?i:(?:[a-z]{2,3}(?:-[a-z]{3}){0,3}|[a-z]{4,8})` +
+		`(?:-[a-z]{4})?` +
+		`(?:-(?:[a-z]{2}|[0-9]{3}))?` +
+		`(?:-(?:[a-z0-9]{5,8}|[0-9][a-z0-9]{3}))*` +
+		`(?:-[0-9a-wy-z](?:-[a-z0-9]{2,8})+)*` +
+		`(?:-x(?:-[a-z0-9]{1,8})+)?` +
+		`|x(?:-[a-z0-9]{1,8})+)$`,
+)
+
+// uuidPattern matches the textual representation of a UUID, the case is not significant
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// initFormat reads the response format, the value must be one of the allowed formats if they are set
+func initFormat(values Values, opts *options) (string, error) {
+	format, _ := scalarValue(values, opts.formatKeyword)
+	if err := checkAllowed(opts.formatKeyword, format, opts.allowedFormats); err != nil {
+		return "", err
+	}
+	return format, nil
+}
+
+// initIncludeDeleted reads the flag which requests soft-deleted records, see initFlag
+func initIncludeDeleted(values Values, opts *options) (bool, error) {
+	return initFlag(values, opts.deletedKeyword, opts)
+}
+
+// initOnlyTrashed reads the flag which requests only soft-deleted records, see initFlag
+func initOnlyTrashed(values Values, opts *options) (bool, error) {
+	return initFlag(values, opts.onlyTrashedKeyword, opts)
+}
+
+// trashScope combines the soft deletion flags read by initIncludeDeleted and initOnlyTrashed,
+// the "onlyTrashed" flag takes precedence, the scope is TrashScopeDefault if none of them is true
+func trashScope(withTrashed, onlyTrashed bool) TrashScope {
+	if onlyTrashed {
+		return TrashScopeOnly
+	}
+	if withTrashed {
+		return TrashScopeWith
+	}
+	return TrashScopeDefault
+}
+
+// initFlag reads the boolean flag, see Values.Bool for the accepted values,
+// an invalid value is ignored i.e. the flag is false, it results in an error in the strict mode
+func initFlag(values Values, keyword string, opts *options) (bool, error) {
+	flag, err := values.Bool(keyword)
+	if err != nil && !opts.strict {
+		return false, nil
+	}
+	return flag, err
+}
+
+// initSortOrder reads the default direction of the sort fields if the order keyword is set,
+// OrderAsc is returned if the param is absent, empty or invalid, an invalid value is an error in the strict mode
+func initSortOrder(values Values, opts *options) (SortOrder, error) {
+	if opts.orderKeyword == "" {
+		return OrderAsc, nil
+	}
+	order, _ := scalarValue(values, opts.orderKeyword)
+	switch strings.ToLower(order) {
+	case "", "asc":
+		return OrderAsc, nil
+	case "desc":
+		return OrderDesc, nil
+	}
+	if opts.strict {
+		return OrderAsc, wrapError(ErrInvalidValue, "qparser: %s %q is not a sort direction, expected one of: asc, desc", opts.orderKeyword, order)
+	}
+	return OrderAsc, nil
+}
+
+// initLocale reads the requested locale, the default locale is used if the param is absent or empty
+// a value which is not a well-formed BCP 47 language tag results in an error in the strict mode,
+// otherwise it is ignored and the default locale is used
+func initLocale(values Values, opts *options) (string, error) {
+	locale, _ := scalarValue(values, opts.localeKeyword)
+	if locale == "" {
+		return opts.defaultLocale, nil
+	}
+	if !languageTagPattern.MatchString(locale) {
+		if opts.strict {
+			return "", wrapError(ErrInvalidValue, "qparser: %s %q is not a valid BCP 47 language tag", opts.localeKeyword, locale)
+		}
+		return opts.defaultLocale, nil
+	}
+	return locale, nil
+}
+
+// initRequestID reads the correlation id passed through the query e.g. "requestId=abc",
+// the value must be a UUID if the validation is enabled
+func initRequestID(values Values, opts *options) (string, error) {
+	id, _ := scalarValue(values, opts.requestIDKeyword)
+	if id != "" && opts.requestIDUUID && !uuidPattern.MatchString(id) {
+		return "", wrapError(ErrInvalidValue, "qparser: %s %q is not a valid UUID", opts.requestIDKeyword, id)
+	}
+	return id, nil
+}
+
+// initCounts reads the comma separated list of the relations whose counts are requested e.g. "counts=comments,tags"
+// the relation names are compared and converted according to the include case mode, duplicates are skipped
+func initCounts(values Values, opts *options) []string {
+	var counts []string
+	for _, val := range values[opts.countsKeyword] {
+		if len(val.NestedKeys) > 0 {
+			continue
+		}
+		for _, relation := range strings.Split(val.Value, opts.relationDelimiter) {
+			if relation == "" {
+				continue
+			}
+			relation = opts.relation(relation)
+			duplicated := false
+			for _, c := range counts {
+				if opts.sameRelation(c, relation) {
+					duplicated = true
+					break
+				}
+			}
+			if !duplicated {
+				counts = append(counts, relation)
+			}
+		}
+	}
+	return counts
+}
+
+// idsDelimiter separates the ids listed in a single value e.g. "ids=1,2,3"
+const idsDelimiter = ","
+
+// initIDs reads the list of the requested resource ids, both the plain keyword "ids=1,2" and the keyword
+// with the empty brackets "ids[]=1&ids[]=2" are recognized, the plain values go first,
+// empty items and duplicates are skipped, the order of the first appearance is preserved
+func initIDs(values Values, opts *options) []string {
+	var ids []string
+	seen := make(map[string]struct{})
+	for _, keyword := range []string{opts.idsKeyword, opts.idsKeyword + listKeySuffix} {
+		for _, val := range values[keyword] {
+			if len(val.NestedKeys) > 0 {
+				continue
+			}
+			for _, id := range strings.Split(val.Value, idsDelimiter) {
+				if id == "" {
+					continue
+				}
+				if _, exist := seen[id]; exist {
+					continue
+				}
+				seen[id] = struct{}{}
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// initProfiles reads the list of the applied JSON:API profiles e.g. "profile=https://example.com/a https://example.com/b"
+// the list is split by any of the profile delimiters, empty items and duplicates are skipped
+func initProfiles(values Values, opts *options) []string {
+	var profiles []string
+	seen := make(map[string]struct{})
+	for _, val := range values[opts.profileKeyword] {
+		if len(val.NestedKeys) > 0 {
+			continue
+		}
+		items := strings.FieldsFunc(val.Value, func(r rune) bool {
+			return strings.ContainsRune(opts.profileDelimiters, r)
+		})
+		for _, profile := range items {
+			if _, exist := seen[profile]; exist {
+				continue
+			}
+			seen[profile] = struct{}{}
+			profiles = append(profiles, profile)
+		}
+	}
+	return profiles
+}
+
+// withSelectedFields returns the values where the bracket-less values of the select keyword are added
+// to the fields of the resource type, e.g. "select=title" is added as "fields[articles]=title"
+// the given values are not modified
+func withSelectedFields(values Values, keyword, fieldsKeyword, resourceType string) Values {
+	selected, ok := values[keyword]
+	if !ok {
+		return values
+	}
+	fields := make([]Value, len(values[fieldsKeyword]), len(values[fieldsKeyword])+len(selected))
+	copy(fields, values[fieldsKeyword])
+	for _, val := range selected {
+		if len(val.NestedKeys) > 0 {
+			continue
+		}
+		fields = append(fields, Value{
+			TopLevelKey: fieldsKeyword,
+			NestedKeys:  []string{resourceType},
+			Value:       val.Value,
+		})
+	}
+	result := make(Values, len(values))
+	for k, v := range values {
+		result[k] = v
+	}
+	result[fieldsKeyword] = fields
+	return result
+}
+
+// scalarValue retrieves the first value of the keyword which has no nested keys
+// the second return value indicates whether such value is set
+func scalarValue(values Values, keyword string) (string, bool) {
+	return values.GetExist(keyword)
+}
+
+// checkAllowed returns an error if the value is not in the allowed list
+// empty value or empty allowed list are always accepted
+func checkAllowed(keyword, value string, allowed []string) error {
+	if value == "" || len(allowed) == 0 {
+		return nil
+	}
+	for _, a := range allowed {
+		if a == value {
+			return nil
+		}
+	}
+	return wrapError(
+		ErrInvalidValue,
+		"qparser: %s %q is not allowed, expected one of: %s",
+		keyword,
+		value,
+		strings.Join(allowed, ", "),
+	)
+}
@@ -0,0 +1,457 @@
+package qparser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type formatTest struct {
+	in          string
+	opts        []Option
+	out         string
+	errContains string
+}
+
+var formatTests = []formatTest{
+	{
+		in:  "",
+		out: "",
+	},
+	{
+		in:  "format=csv",
+		out: "csv",
+	},
+	{
+		in:  "format[nested]=csv",
+		out: "",
+	},
+	{
+		in:   "accept=json",
+		opts: []Option{WithFormatKeyword("accept")},
+		out:  "json",
+	},
+	{
+		in:   "format=json",
+		opts: []Option{WithAllowedFormats("json", "csv")},
+		out:  "json",
+	},
+	{
+		in:   "format=",
+		opts: []Option{WithAllowedFormats("json", "csv")},
+		out:  "",
+	},
+	{
+		in:          "format=xml",
+		opts:        []Option{WithAllowedFormats("json", "csv")},
+		errContains: `format "xml" is not allowed`,
+	},
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, tt := range formatTests {
+		q, err := NewParser(tt.opts...).ParseQuery(tt.in)
+		if err != nil && tt.errContains == "" {
+			t.Errorf("ParseQuery(%q) returned unexpected error %s", tt.in, err)
+			continue
+		}
+		if err == nil && tt.errContains != "" {
+			t.Errorf(
+				"expected ParseQuery(%q) to return error which contains %q, but nil is returned",
+				tt.in,
+				tt.errContains,
+			)
+			continue
+		}
+		if err != nil {
+			if !strings.Contains(err.Error(), tt.errContains) {
+				t.Errorf(
+					`ParseQuery(%q) returned error %q, want something containing %q"`,
+					tt.in,
+					err,
+					tt.errContains,
+				)
+			}
+			continue
+		}
+		if q.Format != tt.out {
+			t.Errorf("ParseQuery(%q) returned format %q, want %q", tt.in, q.Format, tt.out)
+		}
+	}
+}
+
+type includeDeletedTest struct {
+	in   string
+	opts []Option
+	out  bool
+	err  bool
+}
+
+var includeDeletedTests = []includeDeletedTest{
+	{in: "", out: false},
+	{in: "withTrashed", out: true},
+	{in: "withTrashed=1", out: true},
+	{in: "withTrashed=false", out: false},
+	{in: "withTrashed=maybe", out: false},
+	{in: "withTrashed=maybe", opts: []Option{WithStrict(true)}, err: true},
+	{in: "withDeleted=true", opts: []Option{WithIncludeDeletedKeyword("withDeleted")}, out: true},
+	{in: "withTrashed=true", opts: []Option{WithIncludeDeletedKeyword("withDeleted")}, out: false},
+}
+
+func TestParseIncludeDeleted(t *testing.T) {
+	for _, tt := range includeDeletedTests {
+		q, err := NewParser(tt.opts...).ParseQuery(tt.in)
+		if err != nil && !tt.err {
+			t.Errorf("ParseQuery(%q) returned unexpected error %s", tt.in, err)
+			continue
+		}
+		if err == nil && tt.err {
+			t.Errorf("expected ParseQuery(%q) to return error, but nil is returned", tt.in)
+			continue
+		}
+		if err == nil && q.IncludeDeleted != tt.out {
+			t.Errorf("ParseQuery(%q) returned IncludeDeleted %t, want %t", tt.in, q.IncludeDeleted, tt.out)
+		}
+	}
+}
+
+type trashScopeTest struct {
+	in   string
+	opts []Option
+	out  TrashScope
+	err  bool
+}
+
+var trashScopeTests = []trashScopeTest{
+	{in: "", out: TrashScopeDefault},
+	{in: "withTrashed", out: TrashScopeWith},
+	{in: "withTrashed=false", out: TrashScopeDefault},
+	{in: "onlyTrashed", out: TrashScopeOnly},
+	{in: "onlyTrashed=true", out: TrashScopeOnly},
+	{in: "onlyTrashed=0", out: TrashScopeDefault},
+	{in: "onlyTrashed=0&withTrashed", out: TrashScopeWith},
+	{in: "withTrashed&onlyTrashed", out: TrashScopeOnly},
+	{in: "onlyTrashed=maybe", out: TrashScopeDefault},
+	{in: "onlyTrashed=maybe&withTrashed", out: TrashScopeWith},
+	{in: "onlyTrashed=maybe", opts: []Option{WithStrict(true)}, err: true},
+	{in: "withTrashed=maybe", opts: []Option{WithStrict(true)}, err: true},
+	{in: "onlyDeleted", opts: []Option{WithOnlyTrashedKeyword("onlyDeleted")}, out: TrashScopeOnly},
+	{in: "onlyTrashed", opts: []Option{WithOnlyTrashedKeyword("onlyDeleted")}, out: TrashScopeDefault},
+	{in: "withDeleted", opts: []Option{WithIncludeDeletedKeyword("withDeleted")}, out: TrashScopeWith},
+}
+
+func TestParseTrashScope(t *testing.T) {
+	for _, tt := range trashScopeTests {
+		q, err := NewParser(tt.opts...).ParseQuery(tt.in)
+		if err != nil && !tt.err {
+			t.Errorf("ParseQuery(%q) returned unexpected error %s", tt.in, err)
+			continue
+		}
+		if err == nil && tt.err {
+			t.Errorf("expected ParseQuery(%q) to return error, but nil is returned", tt.in)
+			continue
+		}
+		if err == nil && q.TrashScope != tt.out {
+			t.Errorf("ParseQuery(%q) returned TrashScope %v, want %v", tt.in, q.TrashScope, tt.out)
+		}
+	}
+}
+
+type localeTest struct {
+	in   string
+	opts []Option
+	out  string
+	err  bool
+}
+
+var localeTests = []localeTest{
+	{in: "", out: ""},
+	{in: "locale=en", out: "en"},
+	{in: "locale=en-US", out: "en-US"},
+	{in: "locale=zh-Hant-TW", out: "zh-Hant-TW"},
+	{in: "locale=es-419", out: "es-419"},
+	{in: "locale=sl-rozaj-biske", out: "sl-rozaj-biske"},
+	{in: "locale=de-DE-u-co-phonebk", out: "de-DE-u-co-phonebk"},
+	{in: "locale=x-whatever", out: "x-whatever"},
+	{in: "", opts: []Option{WithDefaultLocale("en")}, out: "en"},
+	{in: "locale=", opts: []Option{WithDefaultLocale("en")}, out: "en"},
+	{in: "locale=fr", opts: []Option{WithDefaultLocale("en")}, out: "fr"},
+	{in: "locale=en_US", opts: []Option{WithDefaultLocale("en")}, out: "en"},
+	{in: "locale=e", out: ""},
+	{in: "locale=en_US", opts: []Option{WithStrict(true)}, err: true},
+	{in: "locale=en-", opts: []Option{WithStrict(true)}, err: true},
+	{in: "locale=en-US-", opts: []Option{WithStrict(true), WithDefaultLocale("en")}, err: true},
+	{in: "locale=en-US", opts: []Option{WithStrict(true)}, out: "en-US"},
+	{in: "lang=pt-BR&locale=en", opts: []Option{WithLocaleKeyword("lang")}, out: "pt-BR"},
+}
+
+func TestParseLocale(t *testing.T) {
+	for _, tt := range localeTests {
+		q, err := NewParser(tt.opts...).ParseQuery(tt.in)
+		if err != nil && !tt.err {
+			t.Errorf("ParseQuery(%q) returned unexpected error %s", tt.in, err)
+			continue
+		}
+		if err == nil && tt.err {
+			t.Errorf("expected ParseQuery(%q) to return error, but nil is returned", tt.in)
+			continue
+		}
+		if err == nil && q.Locale != tt.out {
+			t.Errorf("ParseQuery(%q) returned locale %q, want %q", tt.in, q.Locale, tt.out)
+		}
+	}
+}
+
+type countsTest struct {
+	in   string
+	opts []Option
+	out  []string
+}
+
+var countsTests = []countsTest{
+	{in: "", out: nil},
+	{in: "counts=", out: nil},
+	{in: "counts=comments", out: []string{"comments"}},
+	{in: "include=author&counts=comments,,tags,comments&counts=likes", out: []string{"comments", "tags", "likes"}},
+	{in: "counts[nested]=comments", out: nil},
+	{in: "counts=Comments,comments", out: []string{"Comments", "comments"}},
+	{in: "counts=Comments,comments", opts: []Option{WithIncludeCase(IncludeCaseLower)}, out: []string{"comments"}},
+	{in: "counts=Comments,comments", opts: []Option{WithIncludeCase(IncludeCasePreserve)}, out: []string{"Comments"}},
+	{in: "count=comments&counts=tags", opts: []Option{WithCountsKeyword("count")}, out: []string{"comments"}},
+}
+
+func TestParseCounts(t *testing.T) {
+	for _, tt := range countsTests {
+		q, err := NewParser(tt.opts...).ParseQuery(tt.in)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) returned unexpected error %s", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(q.Counts, tt.out) {
+			t.Errorf("ParseQuery(%q) counts:\n\tgot  %+v\n\twant %+v\n", tt.in, q.Counts, tt.out)
+		}
+	}
+}
+
+type profilesTest struct {
+	in   string
+	opts []Option
+	out  []string
+}
+
+var profilesTests = []profilesTest{
+	{in: "", out: nil},
+	{in: "profile=", out: nil},
+	{in: "profile=https://example.com/a", out: []string{"https://example.com/a"}},
+	{
+		in:  "profile=https://example.com/a+https://example.com/b%20https://example.com/a",
+		out: []string{"https://example.com/a", "https://example.com/b"},
+	},
+	{in: "profile=a,b++c", out: []string{"a", "b", "c"}},
+	{in: "profile=a,b+c", opts: []Option{WithProfileDelimiters(" ")}, out: []string{"a,b", "c"}},
+	{in: "profile[x]=a", out: nil},
+	{in: "profiles=a&profile=b", opts: []Option{WithProfileKeyword("profiles")}, out: []string{"a"}},
+}
+
+func TestParseProfiles(t *testing.T) {
+	for _, tt := range profilesTests {
+		q, err := NewParser(tt.opts...).ParseQuery(tt.in)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) returned unexpected error %s", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(q.Profiles, tt.out) {
+			t.Errorf("ParseQuery(%q) profiles:\n\tgot  %+v\n\twant %+v\n", tt.in, q.Profiles, tt.out)
+		}
+	}
+}
+
+type idsTest struct {
+	in   string
+	opts []Option
+	out  []string
+}
+
+var idsTests = []idsTest{
+	{in: "", out: nil},
+	{in: "ids=", out: nil},
+	{in: "ids=1,2,3", out: []string{"1", "2", "3"}},
+	{in: "ids[]=1&ids[]=2&ids[]=1", out: []string{"1", "2"}},
+	{in: "ids=3,,1&ids=1&ids=2", out: []string{"3", "1", "2"}},
+	{in: "ids[]=2&ids=1", out: []string{"1", "2"}},
+	{in: "ids[x]=1", out: nil},
+	{in: "ids[]=1&ids[]=2", opts: []Option{WithStrict(true)}, out: []string{"1", "2"}},
+	{in: "ids=1&ids[]=2", opts: []Option{WithStrict(true)}, out: []string{"1", "2"}},
+	{in: "id[]=1&ids=2", opts: []Option{WithIDsKeyword("id")}, out: []string{"1"}},
+	{in: "ids=1", opts: []Option{WithIDsKeyword("")}, out: []string{"1"}},
+}
+
+func TestParseIDs(t *testing.T) {
+	for _, tt := range idsTests {
+		q, err := NewParser(tt.opts...).ParseQuery(tt.in)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) returned unexpected error %s", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(q.IDs, tt.out) {
+			t.Errorf("ParseQuery(%q) ids:\n\tgot  %+v\n\twant %+v\n", tt.in, q.IDs, tt.out)
+		}
+	}
+}
+
+type requestIDTest struct {
+	in   string
+	opts []Option
+	out  string
+	err  bool
+}
+
+var requestIDTests = []requestIDTest{
+	{in: "", out: ""},
+	{in: "requestId=abc", out: "abc"},
+	{in: "requestId=", out: ""},
+	{in: "requestId[x]=abc", out: ""},
+	{in: "traceId=abc&requestId=def", opts: []Option{WithRequestIDKeyword("traceId")}, out: "abc"},
+	{
+		in:   "requestId=123e4567-e89b-12d3-a456-426614174000",
+		opts: []Option{WithRequestIDUUID(true)},
+		out:  "123e4567-e89b-12d3-a456-426614174000",
+	},
+	{
+		in:   "requestId=123E4567-E89B-12D3-A456-426614174000",
+		opts: []Option{WithRequestIDUUID(true)},
+		out:  "123E4567-E89B-12D3-A456-426614174000",
+	},
+	{in: "requestId=", opts: []Option{WithRequestIDUUID(true)}, out: ""},
+	{in: "requestId=abc", opts: []Option{WithRequestIDUUID(true)}, err: true},
+	{in: "requestId=123e4567e89b12d3a456426614174000", opts: []Option{WithRequestIDUUID(true)}, err: true},
+	{in: "requestId=123e4567-e89b-12d3-a456-42661417400g", opts: []Option{WithRequestIDUUID(true)}, err: true},
+}
+
+func TestParseRequestID(t *testing.T) {
+	for _, tt := range requestIDTests {
+		q, err := NewParser(tt.opts...).ParseQuery(tt.in)
+		if err != nil && !tt.err {
+			t.Errorf("ParseQuery(%q) returned unexpected error %s", tt.in, err)
+			continue
+		}
+		if err == nil && tt.err {
+			t.Errorf("expected ParseQuery(%q) to return error, but nil is returned", tt.in)
+			continue
+		}
+		if err == nil && q.RequestID != tt.out {
+			t.Errorf("ParseQuery(%q) request id %q, want %q", tt.in, q.RequestID, tt.out)
+		}
+	}
+}
+
+type selectKeywordTest struct {
+	in          string
+	keyword     string
+	outFields   ResourceFields
+	outExcluded ResourceFields
+}
+
+var selectKeywordTests = []selectKeywordTest{
+	{
+		in:        "/articles?select=title,body",
+		keyword:   "select",
+		outFields: ResourceFields{"articles": {"title", "body"}},
+	},
+	{
+		in:        "/articles?select=title,body",
+		keyword:   "",
+		outFields: nil,
+	},
+	{
+		in:          "/articles/1?select=title,-secret&fields[articles]=body,title&fields[people]=name",
+		keyword:     "select",
+		outFields:   ResourceFields{"articles": {"body", "title"}, "people": {"name"}},
+		outExcluded: ResourceFields{"articles": {"secret"}},
+	},
+	{
+		in:        "/articles?select[nested]=title",
+		keyword:   "select",
+		outFields: nil,
+	},
+	{
+		in:        "/articles/1/author?select=name",
+		keyword:   "select",
+		outFields: ResourceFields{"author": {"name"}},
+	},
+	{
+		in:        "/articles/1/relationships/comments?select=body",
+		keyword:   "select",
+		outFields: ResourceFields{"comments": {"body"}},
+	},
+	{
+		in:        "/articles?$select=title",
+		keyword:   "$select",
+		outFields: ResourceFields{"articles": {"title"}},
+	},
+}
+
+func TestParseSelectKeyword(t *testing.T) {
+	for _, tt := range selectKeywordTests {
+		r, err := NewParser(WithSelectKeyword(tt.keyword)).ParseRequest(tt.in)
+		if err != nil {
+			t.Errorf("ParseRequest(%q) returned error %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(r.Query.Fields, tt.outFields) {
+			t.Errorf("Fields of %q:\n\tgot  %+v\n\twant %+v\n", tt.in, r.Query.Fields, tt.outFields)
+		}
+		if !reflect.DeepEqual(r.Query.ExcludedFields, tt.outExcluded) {
+			t.Errorf("ExcludedFields of %q:\n\tgot  %+v\n\twant %+v\n", tt.in, r.Query.ExcludedFields, tt.outExcluded)
+		}
+		if _, ok := r.Query.Values[fieldsKeyword]; ok != strings.Contains(tt.in, "fields[") {
+			t.Errorf("Values of %q must not be modified by the select alias, got %+v", tt.in, r.Query.Values)
+		}
+	}
+
+	const query = "select=title"
+	q, err := NewParser(WithSelectKeyword("select")).ParseQuery(query)
+	if err != nil {
+		t.Fatalf("ParseQuery(%q) returned error %v", query, err)
+	}
+	if q.Fields != nil {
+		t.Errorf("ParseQuery(%q) must not apply the select alias, got fields %+v", query, q.Fields)
+	}
+	if encoded := q.Encode(); encoded != query {
+		t.Errorf("Encode() of %q which does not apply the select alias returned %q, want %q", query, encoded, query)
+	}
+}
+
+func TestSelectKeywordRoundTrip(t *testing.T) {
+	p := NewParser(WithSelectKeyword("select"))
+	for _, tt := range selectKeywordTests {
+		if tt.keyword != "select" {
+			continue
+		}
+		r, err := p.ParseRequest(tt.in)
+		if err != nil {
+			t.Fatalf("ParseRequest(%q) returned error %v", tt.in, err)
+		}
+		s := r.String()
+		reparsed, err := p.ParseRequest(s)
+		if err != nil {
+			t.Errorf("ParseRequest(%q) of the encoded %q returned error %v", s, tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(reparsed.Query.Fields, r.Query.Fields) ||
+			!reflect.DeepEqual(reparsed.Query.ExcludedFields, r.Query.ExcludedFields) {
+			t.Errorf(
+				"ParseRequest(%q) of the encoded %q:\n\tgot  %+v, %+v\n\twant %+v, %+v\n",
+				s,
+				tt.in,
+				reparsed.Query.Fields,
+				reparsed.Query.ExcludedFields,
+				r.Query.Fields,
+				r.Query.ExcludedFields,
+			)
+		}
+		if strings.Contains(s, "select=") {
+			t.Errorf("String() of %q returned %q, the selected fields must be encoded as the fieldset", tt.in, s)
+		}
+	}
+}
@@ -0,0 +1,931 @@
+package qparser
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Option configures the Parser
+type Option func(*options)
+
+// options holds the resolved configuration of the Parser
+type options struct {
+	sortDescPrefix string
+	sortFunctions  bool
+	formatKeyword  string
+	allowedFormats []string
+	deletedKeyword string
+	havingKeyword  string
+	localeKeyword  string
+	countsKeyword  string
+	profileKeyword string
+	idsKeyword     string
+
+	onlyTrashedKeyword string
+	orderKeyword       string
+
+	pageKeyword    string
+	sortKeyword    string
+	filterKeyword  string
+	includeKeyword string
+	fieldsKeyword  string
+
+	requestIDKeyword  string
+	requestIDUUID     bool
+	profileDelimiters string
+	defaultLocale     string
+	fieldNameFunc     func(string) string
+
+	keepDuplicateFields bool
+	rejectBlankKeys     bool
+	operatorInKey       bool
+
+	maxValuesPerKey int
+	maxQueryLength  int
+	maxNestedKeys   int
+	maxFields       int
+	strict          bool
+
+	strictSeparators bool
+
+	unboundedPageSize string
+	maxPageValue      int
+	orderedValues     bool
+
+	relationDelimiter       string
+	nestedRelationDelimiter string
+	fieldsDelimiter         string
+	sortDelimiter           string
+	includeCase             IncludeCase
+	includeAliases          []string
+
+	selectKeyword string
+	rawSegments   bool
+	nestedPaths   bool
+
+	minPathSegments int
+	maxPathSegments int
+
+	versionPattern *regexp.Regexp
+
+	decodePlusInPath bool
+	rawMode          bool
+	utf8Mode         UTF8Mode
+
+	requireFilterIncludes bool
+	knownOperators        []string
+
+	onParse  func(time.Duration)
+	onReject func(reason string)
+}
+
+// newOptions returns the default configuration with the given options applied
+func newOptions(opts ...Option) *options {
+	o := &options{
+		sortDescPrefix: string(sortDescChar),
+		formatKeyword:  formatKeyword,
+		deletedKeyword: deletedKeyword,
+		havingKeyword:  havingKeyword,
+		localeKeyword:  localeKeyword,
+		countsKeyword:  countsKeyword,
+		profileKeyword: profileKeyword,
+		idsKeyword:     idsKeyword,
+
+		onlyTrashedKeyword: onlyTrashedKeyword,
+
+		pageKeyword:    pageKeyword,
+		sortKeyword:    sortKeyword,
+		filterKeyword:  filterKeyword,
+		includeKeyword: includeKeyword,
+		fieldsKeyword:  fieldsKeyword,
+
+		requestIDKeyword:  requestIDKeyword,
+		profileDelimiters: profileDelimiters,
+
+		unboundedPageSize: unboundedPageSize,
+
+		relationDelimiter:       string(relationDelimiter),
+		nestedRelationDelimiter: string(nestedRelationDelimiter),
+		fieldsDelimiter:         fieldsDelimiter,
+		sortDelimiter:           string(sortDelimiter),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithSortDescPrefix sets the prefix of a sort field which marks the descending sort order, default is "-"
+// empty prefix is ignored
+func WithSortDescPrefix(prefix string) Option {
+	return func(o *options) {
+		if prefix != "" {
+			o.sortDescPrefix = prefix
+		}
+	}
+}
+
+// WithOrderKeyword enables the keyword of the default direction of the sort fields e.g. "sort=createdAt&order=desc",
+// the value is either "asc" or "desc" in any case, the descending prefix of a field still overrides the direction,
+// an invalid value is ignored or, in the strict mode, results in an error, empty keyword disables it (default)
+func WithOrderKeyword(keyword string) Option {
+	return func(o *options) {
+		o.orderKeyword = keyword
+	}
+}
+
+// WithSortFunctions enables recognition of the function call form of the sort fields e.g. "sort=length(title)",
+// a function takes exactly one argument which is a field name, see Sort.Func
+func WithSortFunctions(enabled bool) Option {
+	return func(o *options) {
+		o.sortFunctions = enabled
+	}
+}
+
+// WithFormatKeyword sets the keyword of the response format parameter, default is "format"
+func WithFormatKeyword(keyword string) Option {
+	return func(o *options) {
+		if keyword != "" {
+			o.formatKeyword = keyword
+		}
+	}
+}
+
+// WithAllowedFormats sets the list of the allowed response formats
+// the parsing fails if the requested format is not in the list, any format is allowed by default
+func WithAllowedFormats(formats ...string) Option {
+	return func(o *options) {
+		o.allowedFormats = formats
+	}
+}
+
+// WithIncludeDeletedKeyword sets the keyword of the flag which requests soft-deleted records, default is "withTrashed"
+func WithIncludeDeletedKeyword(keyword string) Option {
+	return func(o *options) {
+		if keyword != "" {
+			o.deletedKeyword = keyword
+		}
+	}
+}
+
+// WithOnlyTrashedKeyword sets the keyword of the flag which requests only soft-deleted records,
+// default is "onlyTrashed", see Query.TrashScope
+func WithOnlyTrashedKeyword(keyword string) Option {
+	return func(o *options) {
+		if keyword != "" {
+			o.onlyTrashedKeyword = keyword
+		}
+	}
+}
+
+// WithHavingKeyword sets the keyword of the filters of the aggregated values, default is "having"
+func WithHavingKeyword(keyword string) Option {
+	return func(o *options) {
+		if keyword != "" {
+			o.havingKeyword = keyword
+		}
+	}
+}
+
+// WithLocaleKeyword sets the keyword of the requested locale parameter, default is "locale"
+func WithLocaleKeyword(keyword string) Option {
+	return func(o *options) {
+		if keyword != "" {
+			o.localeKeyword = keyword
+		}
+	}
+}
+
+// WithDefaultLocale sets the locale which is used if the locale parameter is absent or invalid, default is empty
+func WithDefaultLocale(locale string) Option {
+	return func(o *options) {
+		o.defaultLocale = locale
+	}
+}
+
+// WithRequestIDKeyword sets the keyword of the correlation id passed through the query, default is "requestId"
+func WithRequestIDKeyword(keyword string) Option {
+	return func(o *options) {
+		if keyword != "" {
+			o.requestIDKeyword = keyword
+		}
+	}
+}
+
+// WithRequestIDUUID enables the validation of the correlation id, a value which is not a UUID
+// e.g. "123e4567-e89b-12d3-a456-426614174000" results in an error
+func WithRequestIDUUID(enabled bool) Option {
+	return func(o *options) {
+		o.requestIDUUID = enabled
+	}
+}
+
+// WithCountsKeyword sets the keyword of the list of the relations whose counts are requested, default is "counts"
+func WithCountsKeyword(keyword string) Option {
+	return func(o *options) {
+		if keyword != "" {
+			o.countsKeyword = keyword
+		}
+	}
+}
+
+// WithProfileKeyword sets the keyword of the list of the applied JSON:API profiles, default is "profile"
+func WithProfileKeyword(keyword string) Option {
+	return func(o *options) {
+		if keyword != "" {
+			o.profileKeyword = keyword
+		}
+	}
+}
+
+// WithIDsKeyword sets the keyword of the list of the requested resource ids, default is "ids"
+func WithIDsKeyword(keyword string) Option {
+	return func(o *options) {
+		if keyword != "" {
+			o.idsKeyword = keyword
+		}
+	}
+}
+
+// WithPageKeyword sets the keyword of the pagination parameters, default is "page"
+// e.g. with the "pagination" keyword 'pagination[size]=10' populates the Query.Page, empty keyword is ignored
+func WithPageKeyword(keyword string) Option {
+	return func(o *options) {
+		if keyword != "" {
+			o.pageKeyword = keyword
+		}
+	}
+}
+
+// WithSortKeyword sets the keyword of the sort fields, default is "sort", empty keyword is ignored
+func WithSortKeyword(keyword string) Option {
+	return func(o *options) {
+		if keyword != "" {
+			o.sortKeyword = keyword
+		}
+	}
+}
+
+// WithFilterKeyword sets the keyword of the filters, default is "filter", empty keyword is ignored
+func WithFilterKeyword(keyword string) Option {
+	return func(o *options) {
+		if keyword != "" {
+			o.filterKeyword = keyword
+		}
+	}
+}
+
+// WithIncludeKeyword sets the keyword of the included relations, default is "include", empty keyword is ignored
+// the aliases set by WithIncludeAliases are recognized in addition to the keyword
+func WithIncludeKeyword(keyword string) Option {
+	return func(o *options) {
+		if keyword != "" {
+			o.includeKeyword = keyword
+		}
+	}
+}
+
+// WithFieldsKeyword sets the keyword of the sparse fieldsets, default is "fields", empty keyword is ignored
+func WithFieldsKeyword(keyword string) Option {
+	return func(o *options) {
+		if keyword != "" {
+			o.fieldsKeyword = keyword
+		}
+	}
+}
+
+// WithProfileDelimiters sets the characters which separate the profiles, default is a space and a comma
+// e.g. " " follows the JSON:API specification strictly, empty value is ignored
+func WithProfileDelimiters(delimiters string) Option {
+	return func(o *options) {
+		if delimiters != "" {
+			o.profileDelimiters = delimiters
+		}
+	}
+}
+
+// WithFieldNameTransformer sets the function which is applied to the field names of the sort and filter parameters
+// and to the field lists of the fields parameter e.g. strings.ToLower, field names are not changed by default
+func WithFieldNameTransformer(fn func(string) string) Option {
+	return func(o *options) {
+		o.fieldNameFunc = fn
+	}
+}
+
+// fieldName applies the field name transformer if it is set
+func (o *options) fieldName(name string) string {
+	if o.fieldNameFunc == nil {
+		return name
+	}
+	return o.fieldNameFunc(name)
+}
+
+// WithMaxValuesPerKey limits the number of values of a single top-level key e.g. "sort=a&sort=a&sort=a" has 3 values,
+// parsing fails if the limit is exceeded, zero or negative value means unlimited which is the default
+func WithMaxValuesPerKey(n int) Option {
+	return func(o *options) {
+		o.maxValuesPerKey = n
+	}
+}
+
+// WithMaxQueryLength limits the length of the query string in bytes, parsing fails if the limit is exceeded,
+// ParseValuesReader stops reading as soon as the limit is exceeded, zero or negative value means unlimited
+// which is the default
+func WithMaxQueryLength(n int) Option {
+	return func(o *options) {
+		o.maxQueryLength = n
+	}
+}
+
+// WithMaxNestedKeys limits the number of the nested keys of a query param name e.g. "a[b][c]" has 2 nested keys,
+// parsing fails as soon as the limit is exceeded regardless of the strict mode,
+// zero or negative value means unlimited which is the default
+func WithMaxNestedKeys(n int) Option {
+	return func(o *options) {
+		o.maxNestedKeys = n
+	}
+}
+
+// WithMaxFieldsPerResource limits the number of the requested fields of a resource, the fields are counted
+// after the duplicates are skipped, the exceeding fields are dropped or, in the strict mode, result in an error,
+// zero or negative value means no limit (default)
+func WithMaxFieldsPerResource(max int) Option {
+	return func(o *options) {
+		o.maxFields = max
+	}
+}
+
+// WithStrict enables the strict mode in which malformed input is rejected with an error instead of being ignored
+// e.g. a query param name which violates the nested keys syntax results in *KeySyntaxError
+func WithStrict(strict bool) Option {
+	return func(o *options) {
+		o.strict = strict
+	}
+}
+
+// WithUnboundedPageSize sets the page size value which requests all records e.g. "page[size]=all",
+// see Page.IsUnbounded, default is "all", empty value disables the recognition
+func WithUnboundedPageSize(sentinel string) Option {
+	return func(o *options) {
+		o.unboundedPageSize = sentinel
+	}
+}
+
+// WithMaxPageValue sets the maximum value accepted by the integer accessors of the page e.g. Page.NumberInt,
+// Page.EffectiveOffset, a greater value results in an error, zero or negative value means no limit (default),
+// values which do not fit into int are rejected regardless of the option
+func WithMaxPageValue(max int) Option {
+	return func(o *options) {
+		o.maxPageValue = max
+	}
+}
+
+// WithOrderedValues enables populating of the Query.OrderedValues list which preserves the original order
+// of the values across different keys
+func WithOrderedValues(enabled bool) Option {
+	return func(o *options) {
+		o.orderedValues = enabled
+	}
+}
+
+// WithIncludeDelimiters sets the delimiter of the included relations and the delimiter of the nested relations,
+// defaults are ',' and '.' e.g. "include=author,comments.author"
+// note that '+' in a query string is decoded as a space, so a literal '+' separator is received as ' '
+// the value is split by the relation delimiter first, so if both delimiters are the same there are no nested relations
+func WithIncludeDelimiters(relation, nested rune) Option {
+	return func(o *options) {
+		o.relationDelimiter = string(relation)
+		o.nestedRelationDelimiter = string(nested)
+	}
+}
+
+// WithFieldsDelimiter sets the delimiter of the fields of a fieldset, default is ',' e.g. "fields[articles]=title|body"
+// the value is split by the delimiter before the exclusion prefix '-' is recognized
+func WithFieldsDelimiter(delimiter rune) Option {
+	return func(o *options) {
+		o.fieldsDelimiter = string(delimiter)
+	}
+}
+
+// WithSortDelimiter sets the delimiter of the sort fields, default is ',' e.g. "sort=-createdAt|title"
+// the value is split by the delimiter before the descending prefix and the nulls order suffixes are recognized
+func WithSortDelimiter(delimiter rune) Option {
+	return func(o *options) {
+		o.sortDelimiter = string(delimiter)
+	}
+}
+
+// WithKeepDuplicateFields disables the deduplication of the field names of a resource,
+// so "fields[articles]=title,body,title" results in all three fields, by default the duplicates are skipped
+func WithKeepDuplicateFields(keep bool) Option {
+	return func(o *options) {
+		o.keepDuplicateFields = keep
+	}
+}
+
+// WithOperatorInKey enables the filters with the operator as the second nested key,
+// "filter[price][gte]=10" is parsed as Filter{FieldName: "price", Predicate: "gte:10"},
+// by default such values are not parsed, see Query.UnparsedFilters
+func WithOperatorInKey(enabled bool) Option {
+	return func(o *options) {
+		o.operatorInKey = enabled
+	}
+}
+
+// WithRejectBlankKeys makes the query params with an empty or whitespace-only top-level or nested key
+// e.g. " =1" or "filter[ ]=1" skipped, in the strict mode such a param results in *KeySyntaxError,
+// by default the blank keys are kept as is
+func WithRejectBlankKeys(reject bool) Option {
+	return func(o *options) {
+		o.rejectBlankKeys = reject
+	}
+}
+
+// WithStrictSeparators makes the parsing fail if the query contains consecutive separators e.g. "a=1&&b=2",
+// by default the empty query params between the separators are skipped
+func WithStrictSeparators(strict bool) Option {
+	return func(o *options) {
+		o.strictSeparators = strict
+	}
+}
+
+// WithUTF8Mode sets how the invalid UTF-8 sequences of the unescaped query param names and values are handled,
+// default is UTF8Keep
+func WithUTF8Mode(mode UTF8Mode) Option {
+	return func(o *options) {
+		o.utf8Mode = mode
+	}
+}
+
+// WithIncludeCase sets how the relation names of the includes are compared and stored,
+// default is IncludeCaseSensitive
+func WithIncludeCase(c IncludeCase) Option {
+	return func(o *options) {
+		o.includeCase = c
+	}
+}
+
+// WithIncludeAliases sets the keywords which are recognized in addition to "include" e.g. "expand" or "$expand"
+// for OData-style clients, the relations of all keywords are merged, include comes first
+func WithIncludeAliases(keywords ...string) Option {
+	return func(o *options) {
+		o.includeAliases = keywords
+	}
+}
+
+// relation converts the relation name according to the include case mode
+func (o *options) relation(name string) string {
+	if o.includeCase == IncludeCaseLower {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+// sameRelation compares the relation names according to the include case mode
+func (o *options) sameRelation(a, b string) bool {
+	if o.includeCase == IncludeCaseSensitive {
+		return a == b
+	}
+	return strings.EqualFold(a, b)
+}
+
+// WithSelectKeyword enables the bracket-less alias of the fields parameter for the requested resource,
+// e.g. with the "select" keyword "/articles?select=title,body" is the same as "/articles?fields[articles]=title,body"
+// the fields of a related resource or relationship request are keyed by the relation name,
+// e.g. "/articles/1/author?select=name" is the same as "/articles/1/author?fields[author]=name"
+// the alias is applied by ParseRequest and ParsePathAndQuery only since the resource type is taken from the path,
+// it is disabled by default
+func WithSelectKeyword(keyword string) Option {
+	return func(o *options) {
+		o.selectKeyword = keyword
+	}
+}
+
+// WithRawSegments enables populating of the Request.RawSegments list which contains the path segments
+// as they are received, before unescaping, e.g. when the escaping of an ID matters for a lookup
+func WithRawSegments(enabled bool) Option {
+	return func(o *options) {
+		o.rawSegments = enabled
+	}
+}
+
+// WithNestedPaths enables the paths which navigate through the related resources
+// e.g. "/articles/1/comments/5/author" or "/articles/1/comments/5/relationships/author", see Request.NestedResources
+func WithNestedPaths(enabled bool) Option {
+	return func(o *options) {
+		o.nestedPaths = enabled
+	}
+}
+
+// WithMinPathSegments sets the minimum number of the path segments e.g. 2 requires a resource id,
+// parsing fails if the path is shorter, default is 1
+func WithMinPathSegments(n int) Option {
+	return func(o *options) {
+		o.minPathSegments = n
+	}
+}
+
+// WithMaxPathSegments sets the maximum number of the path segments, parsing fails if the path is longer
+// default is 4 or unlimited if the nested paths are enabled, see WithNestedPaths
+// note that the paths longer than 4 segments are recognized only if the nested paths are enabled
+func WithMaxPathSegments(n int) Option {
+	return func(o *options) {
+		o.maxPathSegments = n
+	}
+}
+
+// defaultVersionPattern matches the version segments such as "v1" or "v42"
+var defaultVersionPattern = regexp.MustCompile(`^v\d+$`)
+
+// WithVersionSegment enables the recognition of the leading API version segment e.g. "/v1/articles/42",
+// the segment is stored in Request.Version and the rest of the path is parsed as usual,
+// the pattern must match the whole segment, nil pattern means the default one "^v\d+$"
+// the segment is not recognized if it is the only one
+func WithVersionSegment(pattern *regexp.Regexp) Option {
+	return func(o *options) {
+		if pattern == nil {
+			pattern = defaultVersionPattern
+		}
+		o.versionPattern = pattern
+	}
+}
+
+// WithDecodePlusInPath makes the plus sign '+' in the path segments decoded as a space for the clients which encode
+// spaces the query string way, an escaped plus "%2B" is still decoded as '+'
+// by default the plus sign is kept as is according to RFC 3986
+func WithDecodePlusInPath(enabled bool) Option {
+	return func(o *options) {
+		o.decodePlusInPath = enabled
+	}
+}
+
+// WithRawMode disables the unescaping of the query and the path for the input which is already decoded
+// e.g. by a framework, so "%2F" and '+' are kept as is and a decoded '%' is not unescaped twice,
+// the WithDecodePlusInPath option has no effect in the raw mode
+func WithRawMode(enabled bool) Option {
+	return func(o *options) {
+		o.rawMode = enabled
+	}
+}
+
+// WithRequireFilterIncludes makes the parsing fail if a scoped filter refers to a relation which is not included
+// e.g. "filter[author.name]=eq:bob" without "include=author", see Query.ScopedFilters
+func WithRequireFilterIncludes(enabled bool) Option {
+	return func(o *options) {
+		o.requireFilterIncludes = enabled
+	}
+}
+
+// WithKnownOperators sets the list of the operators which can be used in the filter predicates
+// e.g. "eq", "ne", "lt", "gt", parsing fails if a filter uses an unknown operator, see Filter.Operator
+// the predicates without an operator are accepted as well as the predicates whose part before the colon
+// is not an operator name e.g. the timestamp "2020-01-01T10:00:00", any operator is allowed by default
+func WithKnownOperators(operators ...string) Option {
+	return func(o *options) {
+		o.knownOperators = operators
+	}
+}
+
+// WithOnParse sets the hook which receives the duration of every ParseQuery, ParseQueryKeywords,
+// ParseQueryFromURLValues, ParseRequest, ParseRequests (per request), ParsePathAndQuery and ParseHTTPRequest call
+// including the rejected ones, e.g. to feed a histogram
+func WithOnParse(fn func(dur time.Duration)) Option {
+	return func(o *options) {
+		o.onParse = fn
+	}
+}
+
+// WithOnReject sets the hook which receives the error message of every rejected call of the entry points
+// listed by WithOnParse, e.g. to increment a counter
+func WithOnReject(fn func(reason string)) Option {
+	return func(o *options) {
+		o.onReject = fn
+	}
+}
+
+// Parser parses requests and queries according to its options
+// the package level functions use the parser with the default options
+type Parser struct {
+	opts     *options
+	handlers []keywordHandler
+}
+
+// KeywordHandler parses the values of a custom top-level keyword and writes the result onto the query
+// values is nil if the keyword is absent in the query string
+type KeywordHandler func(values []Value, q *Query)
+
+type keywordHandler struct {
+	keyword string
+	fn      KeywordHandler
+}
+
+// RegisterHandler registers the handler of a custom top-level keyword e.g. "geo" or "facets"
+// the handlers are invoked by ParseQuery after the built-in keywords are parsed, in the order of registration
+// registering a handler for the same keyword replaces the previous one
+// RegisterHandler must not be called concurrently with parsing
+func (p *Parser) RegisterHandler(keyword string, fn KeywordHandler) {
+	for i := range p.handlers {
+		if p.handlers[i].keyword == keyword {
+			p.handlers[i].fn = fn
+			return
+		}
+	}
+	p.handlers = append(p.handlers, keywordHandler{keyword: keyword, fn: fn})
+}
+
+// NewParser creates a new Parser configured with the given options
+func NewParser(opts ...Option) *Parser {
+	return &Parser{opts: newOptions(opts...)}
+}
+
+var defaultParser = NewParser()
+
+// ParseValues parses a string and returns a structure filled with the corresponding values
+// see the package level ParseValues for the description of the format
+func (p *Parser) ParseValues(query string) (Values, error) {
+	values, _, err := parseValues(query, p.opts)
+	return values, err
+}
+
+// ParseValuesReader parses the query read from the reader
+// see the package level ParseValuesReader for the details
+func (p *Parser) ParseValuesReader(r io.Reader) (Values, error) {
+	values, _, err := parseValuesReader(r, p.opts)
+	return values, err
+}
+
+// FromURLValues converts the url.Values into the Values, see the package level FromURLValues
+func (p *Parser) FromURLValues(v url.Values) (Values, error) {
+	values, _, err := parseURLValues(v, p.opts)
+	return values, err
+}
+
+// ParseQueryFromURLValues works like ParseQuery, but the query is given as url.Values
+// see the package level FromURLValues for the details
+func (p *Parser) ParseQueryFromURLValues(v url.Values) (*Query, error) {
+	start := p.startObserving()
+	values, ordered, err := parseURLValues(v, p.opts)
+	var q *Query
+	if err == nil {
+		q, err = p.queryFromValues(values, ordered, "", nil)
+	}
+	p.observe(start, err)
+	return q, err
+}
+
+// ParseQuery parses a string and returns a structure filled with the corresponding values
+// see the package level ParseQuery for the description of the format
+func (p *Parser) ParseQuery(query string) (*Query, error) {
+	start := p.startObserving()
+	q, err := p.parseQuery(query, "")
+	p.observe(start, err)
+	return q, err
+}
+
+// ParseQueryKeywords works like ParseQuery, but only the given keywords e.g. "page", "sort" are parsed,
+// see the package level ParseQueryKeywords
+func (p *Parser) ParseQueryKeywords(query string, keywords ...string) (*Query, error) {
+	start := p.startObserving()
+	only := make(map[string]struct{}, len(keywords))
+	for _, keyword := range keywords {
+		only[keyword] = struct{}{}
+	}
+	q, err := p.parseQueryKeywords(query, "", only)
+	p.observe(start, err)
+	return q, err
+}
+
+// parseQuery parses the query, resourceType is the type of the requested resource if it is known
+func (p *Parser) parseQuery(query, resourceType string) (*Query, error) {
+	return p.parseQueryKeywords(query, resourceType, nil)
+}
+
+// parseQueryKeywords parses the query, only the keywords from the set are processed, nil set means all keywords
+func (p *Parser) parseQueryKeywords(query, resourceType string, only map[string]struct{}) (*Query, error) {
+	values, ordered, err := parseValues(query, p.opts)
+	if err != nil {
+		return nil, err
+	}
+	return p.queryFromValues(values, ordered, resourceType, only)
+}
+
+// queryFromValues builds the query from the parsed values, see parseQueryKeywords
+func (p *Parser) queryFromValues(values Values, ordered []Value, resourceType string, only map[string]struct{}) (*Query, error) {
+	var err error
+	wanted := func(keyword string) bool {
+		if only == nil {
+			return true
+		}
+		_, ok := only[keyword]
+		return ok
+	}
+	wantedAny := func(keywords []string) bool {
+		for _, keyword := range keywords {
+			if wanted(keyword) {
+				return true
+			}
+		}
+		return false
+	}
+	result := &Query{
+		Values:        values,
+		OrderedValues: ordered,
+		syntax:        newQuerySyntax(p.opts),
+	}
+	if wanted(p.opts.formatKeyword) {
+		if result.Format, err = initFormat(values, p.opts); err != nil {
+			return nil, err
+		}
+	}
+	// each of the soft deletion flags is read only if it is wanted, the scope is combined from the read ones
+	var onlyTrashed bool
+	if wanted(p.opts.deletedKeyword) {
+		if result.IncludeDeleted, err = initIncludeDeleted(values, p.opts); err != nil {
+			return nil, err
+		}
+	}
+	if wanted(p.opts.onlyTrashedKeyword) {
+		if onlyTrashed, err = initOnlyTrashed(values, p.opts); err != nil {
+			return nil, err
+		}
+	}
+	result.TrashScope = trashScope(result.IncludeDeleted, onlyTrashed)
+	if wanted(p.opts.localeKeyword) {
+		if result.Locale, err = initLocale(values, p.opts); err != nil {
+			return nil, err
+		}
+	}
+	if wanted(p.opts.requestIDKeyword) {
+		if result.RequestID, err = initRequestID(values, p.opts); err != nil {
+			return nil, err
+		}
+	}
+	if wanted(p.opts.includeKeyword) || wantedAny(p.opts.includeAliases) {
+		result.Includes = initIncludes(values, p.opts)
+		result.ExcludedIncludes = initExcludedIncludes(values, p.opts)
+	}
+	if wanted(p.opts.fieldsKeyword) {
+		fieldValues := values
+		if resourceType != "" && p.opts.selectKeyword != "" {
+			fieldValues = withSelectedFields(values, p.opts.selectKeyword, p.opts.fieldsKeyword, resourceType)
+			syntax := defaultQuerySyntax
+			if result.syntax != nil {
+				syntax = *result.syntax
+			}
+			syntax.selectKeyword = p.opts.selectKeyword
+			result.syntax = &syntax
+		}
+		result.Fields = initResourceFields(fieldValues, p.opts)
+		result.ExcludedFields = initExcludedFields(fieldValues, p.opts)
+		if err := limitResourceFields(result.Fields, p.opts); err != nil {
+			return nil, err
+		}
+	}
+	if wanted(p.opts.sortKeyword) {
+		order, err := initSortOrder(values, p.opts)
+		if err != nil {
+			return nil, err
+		}
+		result.Sort = initSort(values, p.opts)
+		// the prefixed fields keep their own direction
+		if order == OrderDesc {
+			for i := range result.Sort {
+				if !result.Sort[i].ExplicitOrder {
+					result.Sort[i].Order = OrderDesc
+				}
+			}
+		}
+	}
+	if wanted(p.opts.filterKeyword) {
+		result.Filters = initFilters(values, p.opts)
+	}
+	if wanted(p.opts.havingKeyword) {
+		result.Having = initHaving(values, p.opts)
+	}
+	if wanted(p.opts.countsKeyword) {
+		result.Counts = initCounts(values, p.opts)
+	}
+	if wanted(p.opts.profileKeyword) {
+		result.Profiles = initProfiles(values, p.opts)
+	}
+	if wanted(p.opts.idsKeyword) {
+		result.IDs = initIDs(values, p.opts)
+	}
+	if wanted(p.opts.pageKeyword) {
+		if result.Page, err = initPage(values, p.opts); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkOperators(p.opts.filterKeyword, result.Filters, p.opts.knownOperators); err != nil {
+		return nil, err
+	}
+	if err := checkOperators(p.opts.havingKeyword, result.Having, p.opts.knownOperators); err != nil {
+		return nil, err
+	}
+	// the check needs the includes, so it is skipped if they are not parsed
+	if p.opts.requireFilterIncludes && (wanted(p.opts.includeKeyword) || wantedAny(p.opts.includeAliases)) {
+		if err := checkFilterIncludes(result.Filters, result.Includes, p.opts); err != nil {
+			return nil, err
+		}
+	}
+	for _, h := range p.handlers {
+		if wanted(h.keyword) {
+			h.fn(values[h.keyword], result)
+		}
+	}
+
+	return result, nil
+}
+
+// ParseRequest parses the string into a path and a query, which are expected to be separated by a question mark '?'
+// see the package level ParseRequest for the description of the format
+func (p *Parser) ParseRequest(params string) (*Request, error) {
+	start := p.startObserving()
+	path, query := splitRequest(params)
+	r, err := p.parsePathAndQuery(path, query)
+	p.observe(start, err)
+	return r, err
+}
+
+// ParseRequests parses each of the requests independently, see the package level ParseRequests
+func (p *Parser) ParseRequests(requests []string) ([]*Request, []error) {
+	if len(requests) == 0 {
+		return nil, nil
+	}
+	parsed := make([]*Request, len(requests))
+	errs := make([]error, len(requests))
+	for i, params := range requests {
+		parsed[i], errs[i] = p.ParseRequest(params)
+	}
+	return parsed, errs
+}
+
+// splitRequest separates the path and the query, an absolute URL e.g. "https://host/articles?x=1"
+// is recognized, so its scheme and host are not taken as the path segments, the fragment is dropped
+func splitRequest(params string) (path, query string) {
+	if strings.Contains(params, "://") {
+		if u, err := url.Parse(params); err == nil && u.IsAbs() && u.Host != "" {
+			return u.EscapedPath(), u.RawQuery
+		}
+	}
+	return split(params, '?', true)
+}
+
+// ParsePathAndQuery parses the path and the query which are already separated
+// see the package level ParsePathAndQuery for the details
+func (p *Parser) ParsePathAndQuery(path, query string) (*Request, error) {
+	start := p.startObserving()
+	r, err := p.parsePathAndQuery(path, query)
+	p.observe(start, err)
+	return r, err
+}
+
+// ParseHTTPRequest parses the path and the query of the HTTP request
+// see the package level ParseHTTPRequest for the details
+func (p *Parser) ParseHTTPRequest(r *http.Request) (*Request, error) {
+	start := p.startObserving()
+	if r == nil || r.URL == nil {
+		err := errors.New("qparser: cannot parse HTTP request, request or its URL is nil")
+		p.observe(start, err)
+		return nil, err
+	}
+	request, err := p.parsePathAndQuery(r.URL.EscapedPath(), r.URL.RawQuery)
+	p.observe(start, err)
+	return request, err
+}
+
+func (p *Parser) parsePathAndQuery(path, query string) (*Request, error) {
+	request, err := parsePath(path, p.opts)
+	if err != nil {
+		return nil, err
+	}
+	q, err := p.parseQuery(query, request.primaryDataType())
+	if err != nil {
+		return nil, err
+	}
+	request.Query = q
+	return request, nil
+}
+
+// startObserving returns the current time if the parse hook is set
+func (p *Parser) startObserving() time.Time {
+	if p.opts.onParse == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// observe invokes the hooks with the result of parsing
+func (p *Parser) observe(start time.Time, err error) {
+	if p.opts.onParse != nil {
+		p.opts.onParse(time.Since(start))
+	}
+	if err != nil && p.opts.onReject != nil {
+		p.opts.onReject(err.Error())
+	}
+}
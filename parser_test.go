@@ -0,0 +1,1644 @@
+package qparser
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sortDescPrefixTest struct {
+	prefix string
+	in     string
+	out    []Sort
+}
+
+var sortDescPrefixTests = []sortDescPrefixTest{
+	{
+		prefix: "!",
+		in:     "sort=!createdAt,title,-name",
+		out: []Sort{
+			{FieldName: "createdAt", Order: OrderDesc, ExplicitOrder: true},
+			{FieldName: "title", Order: OrderAsc},
+			{FieldName: "-name", Order: OrderAsc},
+		},
+	},
+	{
+		prefix: "desc:",
+		in:     "sort=desc:createdAt,title",
+		out: []Sort{
+			{FieldName: "createdAt", Order: OrderDesc, ExplicitOrder: true},
+			{FieldName: "title", Order: OrderAsc},
+		},
+	},
+	{
+		prefix: "",
+		in:     "sort=-createdAt",
+		out: []Sort{
+			{FieldName: "createdAt", Order: OrderDesc, ExplicitOrder: true},
+		},
+	},
+	{
+		prefix: "!",
+		in:     "sort=!",
+		out:    nil,
+	},
+}
+
+func TestParserSortDescPrefix(t *testing.T) {
+	for _, tt := range sortDescPrefixTests {
+		q, err := NewParser(WithSortDescPrefix(tt.prefix)).ParseQuery(tt.in)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) with sort desc prefix %q returned error %v", tt.in, tt.prefix, err)
+			continue
+		}
+		if !reflect.DeepEqual(q.Sort, tt.out) {
+			t.Errorf(
+				"ParseQuery(%q) with sort desc prefix %q:\n\tgot  %+v\n\twant %+v\n",
+				tt.in,
+				tt.prefix,
+				q.Sort,
+				tt.out,
+			)
+		}
+	}
+}
+
+type orderKeywordTest struct {
+	in     string
+	opts   []Option
+	out    []Sort
+	errors bool
+}
+
+var orderKeywordTests = []orderKeywordTest{
+	{
+		in:   "sort=createdAt,-title&order=desc",
+		opts: []Option{WithOrderKeyword("order")},
+		out:  []Sort{{FieldName: "createdAt", Order: OrderDesc}, {FieldName: "title", Order: OrderDesc, ExplicitOrder: true}},
+	},
+	{
+		in:   "sort=%2Bname,title&order=desc",
+		opts: []Option{WithOrderKeyword("order")},
+		out:  []Sort{{FieldName: "name", Order: OrderAsc, ExplicitOrder: true}, {FieldName: "title", Order: OrderDesc}},
+	},
+	{
+		in:   "sort=createdAt,-title&order=ASC",
+		opts: []Option{WithOrderKeyword("order")},
+		out:  []Sort{{FieldName: "createdAt", Order: OrderAsc}, {FieldName: "title", Order: OrderDesc, ExplicitOrder: true}},
+	},
+	{
+		in:   "sort=createdAt&order=DESC",
+		opts: []Option{WithOrderKeyword("order")},
+		out:  []Sort{{FieldName: "createdAt", Order: OrderDesc}},
+	},
+	{
+		in:   "sort=createdAt&dir=desc",
+		opts: []Option{WithOrderKeyword("dir")},
+		out:  []Sort{{FieldName: "createdAt", Order: OrderDesc}},
+	},
+	{
+		in:   "sort=createdAt&order=desc",
+		opts: nil,
+		out:  []Sort{{FieldName: "createdAt", Order: OrderAsc}},
+	},
+	{
+		in:   "sort=createdAt&order=down",
+		opts: []Option{WithOrderKeyword("order")},
+		out:  []Sort{{FieldName: "createdAt", Order: OrderAsc}},
+	},
+	{
+		in:     "sort=createdAt&order=down",
+		opts:   []Option{WithOrderKeyword("order"), WithStrict(true)},
+		errors: true,
+	},
+	{
+		in:   "order=desc",
+		opts: []Option{WithOrderKeyword("order")},
+		out:  nil,
+	},
+}
+
+func TestParserOrderKeyword(t *testing.T) {
+	for _, tt := range orderKeywordTests {
+		q, err := NewParser(tt.opts...).ParseQuery(tt.in)
+		if err != nil && !tt.errors {
+			t.Errorf("ParseQuery(%q) returned unexpected error %s", tt.in, err)
+			continue
+		}
+		if err == nil && tt.errors {
+			t.Errorf("expected ParseQuery(%q) to return error, but nil is returned", tt.in)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(q.Sort, tt.out) {
+			t.Errorf("ParseQuery(%q):\n\tgot  %+v\n\twant %+v\n", tt.in, q.Sort, tt.out)
+		}
+	}
+}
+
+func TestParserRegisterHandler(t *testing.T) {
+	const query = "geo[lat]=1.5&geo[lng]=2.5&sort=title"
+
+	p := NewParser()
+	var got []Value
+	calls := 0
+	p.RegisterHandler("geo", func(values []Value, q *Query) {
+		t.Errorf("replaced handler must not be invoked")
+	})
+	p.RegisterHandler("geo", func(values []Value, q *Query) {
+		calls++
+		got = values
+		if len(q.Sort) != 1 {
+			t.Errorf("handler is invoked before the built-in keywords are parsed")
+		}
+		q.Values["geo-point"] = []Value{{TopLevelKey: "geo-point", Value: "1.5,2.5"}}
+	})
+	p.RegisterHandler("facets", func(values []Value, q *Query) {
+		calls++
+		if values != nil {
+			t.Errorf("handler of the absent keyword received values %+v, want nil", values)
+		}
+	})
+
+	q, err := p.ParseQuery(query)
+	if err != nil {
+		t.Fatalf("ParseQuery(%q) returned error %v", query, err)
+	}
+	if calls != 2 {
+		t.Errorf("handlers are called %d times, want 2", calls)
+	}
+	expected := []Value{
+		{TopLevelKey: "geo", NestedKeys: []string{"lat"}, Value: "1.5"},
+		{TopLevelKey: "geo", NestedKeys: []string{"lng"}, Value: "2.5"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("handler received values:\n\tgot  %+v\n\twant %+v\n", got, expected)
+	}
+	if v := q.Values.Get("geo-point"); v != "1.5,2.5" {
+		t.Errorf("Values.Get(\"geo-point\") returned %q, want %q", v, "1.5,2.5")
+	}
+}
+
+func TestParserHandlerExtensions(t *testing.T) {
+	type point struct {
+		lat, lng string
+	}
+	p := NewParser()
+	p.RegisterHandler("geo", func(values []Value, q *Query) {
+		if values == nil {
+			return
+		}
+		q.SetExtension("geo", point{lat: q.Values.Get("geo", "lat"), lng: q.Values.Get("geo", "lng")})
+	})
+
+	const query = "geo[lat]=1.5&geo[lng]=2.5"
+	q, err := p.ParseQuery(query)
+	if err != nil {
+		t.Fatalf("ParseQuery(%q) returned error %v", query, err)
+	}
+	v, ok := q.GetExtension("geo")
+	if !ok || v != (point{lat: "1.5", lng: "2.5"}) {
+		t.Errorf("GetExtension(\"geo\") returned %+v, %t; want the parsed point", v, ok)
+	}
+
+	q, err = p.ParseQuery("sort=title")
+	if err != nil {
+		t.Fatalf("ParseQuery() returned error %v", err)
+	}
+	if q.Extensions != nil {
+		t.Errorf("Extensions must not be populated by the built-in parsing, got %+v", q.Extensions)
+	}
+	if v, ok := q.GetExtension("geo"); ok || v != nil {
+		t.Errorf("GetExtension(\"geo\") of the absent extension returned %+v, %t; want nil, false", v, ok)
+	}
+	var nilQuery *Query
+	if v, ok := nilQuery.GetExtension("geo"); ok || v != nil {
+		t.Errorf("GetExtension(\"geo\") of nil query returned %+v, %t; want nil, false", v, ok)
+	}
+}
+
+func TestParserFieldNameTransformer(t *testing.T) {
+	const query = "sort=-CreatedAt,createdAt,Title&filter[Title]=eq:Foo&fields[Articles]=Title,title,-Secret"
+
+	q, err := NewParser(WithFieldNameTransformer(strings.ToLower)).ParseQuery(query)
+	if err != nil {
+		t.Fatalf("ParseQuery(%q) returned error %v", query, err)
+	}
+	expectedSort := []Sort{
+		{FieldName: "createdat", Order: OrderDesc, ExplicitOrder: true},
+		{FieldName: "title", Order: OrderAsc},
+	}
+	if !reflect.DeepEqual(q.Sort, expectedSort) {
+		t.Errorf("Sort of %q:\n\tgot  %+v\n\twant %+v\n", query, q.Sort, expectedSort)
+	}
+	expectedFilters := []Filter{{FieldName: "title", Predicate: "eq:Foo", Op: "eq", Value: "Foo"}}
+	if !reflect.DeepEqual(q.Filters, expectedFilters) {
+		t.Errorf("Filters of %q:\n\tgot  %+v\n\twant %+v\n", query, q.Filters, expectedFilters)
+	}
+	expectedFields := ResourceFields{"Articles": {"title"}}
+	if !reflect.DeepEqual(q.Fields, expectedFields) {
+		t.Errorf("Fields of %q:\n\tgot  %+v\n\twant %+v\n", query, q.Fields, expectedFields)
+	}
+	expectedExcluded := ResourceFields{"Articles": {"secret"}}
+	if !reflect.DeepEqual(q.ExcludedFields, expectedExcluded) {
+		t.Errorf("ExcludedFields of %q:\n\tgot  %+v\n\twant %+v\n", query, q.ExcludedFields, expectedExcluded)
+	}
+}
+
+type keepDuplicateFieldsTest struct {
+	in   string
+	keep bool
+	out  ResourceFields
+}
+
+var keepDuplicateFieldsTests = []keepDuplicateFieldsTest{
+	{in: "fields[articles]=title,body,title", keep: false, out: ResourceFields{"articles": {"title", "body"}}},
+	{in: "fields[articles]=title,body,title", keep: true, out: ResourceFields{"articles": {"title", "body", "title"}}},
+	{
+		in:   "fields[articles]=title,title&fields[articles]=body,title",
+		keep: true,
+		out:  ResourceFields{"articles": {"title", "title", "body", "title"}},
+	},
+	{in: "fields[articles]=title,,title", keep: true, out: ResourceFields{"articles": {"title", "title"}}},
+}
+
+func TestParserKeepDuplicateFields(t *testing.T) {
+	for _, tt := range keepDuplicateFieldsTests {
+		q, err := NewParser(WithKeepDuplicateFields(tt.keep)).ParseQuery(tt.in)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) returned error %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(q.Fields, tt.out) {
+			t.Errorf("ParseQuery(%q) with keep duplicates %t:\n\tgot  %+v\n\twant %+v\n", tt.in, tt.keep, q.Fields, tt.out)
+		}
+	}
+}
+
+type maxFieldsPerResourceTest struct {
+	in          string
+	opts        []Option
+	out         ResourceFields
+	errContains string
+}
+
+var maxFieldsPerResourceTests = []maxFieldsPerResourceTest{
+	{
+		in:   "fields[articles]=a,b,c,d",
+		opts: nil,
+		out:  ResourceFields{"articles": {"a", "b", "c", "d"}},
+	},
+	{
+		in:   "fields[articles]=a,b,a,b,c&fields[people]=x",
+		opts: []Option{WithMaxFieldsPerResource(3)},
+		out:  ResourceFields{"articles": {"a", "b", "c"}, "people": {"x"}},
+	},
+	{
+		in:   "fields[articles]=a,b,c,d&fields[people]=x,-y,-z",
+		opts: []Option{WithMaxFieldsPerResource(3)},
+		out:  ResourceFields{"articles": {"a", "b", "c"}, "people": {"x"}},
+	},
+	{
+		in:   "fields[articles]=a,b,a,b,c",
+		opts: []Option{WithMaxFieldsPerResource(3), WithStrict(true)},
+		out:  ResourceFields{"articles": {"a", "b", "c"}},
+	},
+	{
+		in:          "fields[articles]=a,b&fields[articles]=c,d",
+		opts:        []Option{WithMaxFieldsPerResource(3), WithStrict(true)},
+		errContains: `too many fields of the resource "articles", the maximum is 3`,
+	},
+	{
+		in:          "fields[articles]=a,a,b",
+		opts:        []Option{WithMaxFieldsPerResource(2), WithKeepDuplicateFields(true), WithStrict(true)},
+		errContains: "too many fields",
+	},
+}
+
+func TestParserMaxFieldsPerResource(t *testing.T) {
+	for _, tt := range maxFieldsPerResourceTests {
+		q, err := NewParser(tt.opts...).ParseQuery(tt.in)
+		if tt.errContains != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.errContains) {
+				t.Errorf("ParseQuery(%q) returned error %v, want something containing %q", tt.in, err, tt.errContains)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseQuery(%q) returned unexpected error %s", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(q.Fields, tt.out) {
+			t.Errorf("ParseQuery(%q):\n\tgot  %+v\n\twant %+v\n", tt.in, q.Fields, tt.out)
+		}
+	}
+}
+
+type maxValuesPerKeyTest struct {
+	max         int
+	in          string
+	errContains string
+}
+
+var maxValuesPerKeyTests = []maxValuesPerKeyTest{
+	{
+		max: 0,
+		in:  "sort=a&sort=a&sort=a&sort=a",
+	},
+	{
+		max: 3,
+		in:  "sort=a&sort=a&sort=a&page[size]=1&page[number]=1",
+	},
+	{
+		max:         3,
+		in:          "sort=a&sort=a&sort=a&sort=a",
+		errContains: `too many values of the query param "sort"`,
+	},
+	{
+		max:         1,
+		in:          "page[size]=1&page[number]=1",
+		errContains: `too many values of the query param "page"`,
+	},
+}
+
+func TestParserMaxValuesPerKey(t *testing.T) {
+	for _, tt := range maxValuesPerKeyTests {
+		_, err := NewParser(WithMaxValuesPerKey(tt.max)).ParseValues(tt.in)
+		if err != nil && tt.errContains == "" {
+			t.Errorf("ParseValues(%q) with max %d returned unexpected error %s", tt.in, tt.max, err)
+			continue
+		}
+		if err == nil && tt.errContains != "" {
+			t.Errorf(
+				"expected ParseValues(%q) with max %d to return error which contains %q, but nil is returned",
+				tt.in,
+				tt.max,
+				tt.errContains,
+			)
+			continue
+		}
+		if err != nil && !strings.Contains(err.Error(), tt.errContains) {
+			t.Errorf(
+				`ParseValues(%q) with max %d returned error %q, want something containing %q"`,
+				tt.in,
+				tt.max,
+				err,
+				tt.errContains,
+			)
+		}
+	}
+}
+
+func TestParserOrderedValues(t *testing.T) {
+	const query = "sort=title&page[size]=1&sort=-createdAt&include=author"
+
+	q, err := NewParser(WithOrderedValues(true)).ParseQuery(query)
+	if err != nil {
+		t.Fatalf("ParseQuery(%q) returned error %v", query, err)
+	}
+	expected := []Value{
+		{TopLevelKey: "sort", Value: "title"},
+		{TopLevelKey: "page", NestedKeys: []string{"size"}, Value: "1"},
+		{TopLevelKey: "sort", Value: "-createdAt"},
+		{TopLevelKey: "include", Value: "author"},
+	}
+	if !reflect.DeepEqual(q.OrderedValues, expected) {
+		t.Errorf("OrderedValues of %q:\n\tgot  %+v\n\twant %+v\n", query, q.OrderedValues, expected)
+	}
+	if len(q.Values["sort"]) != 2 {
+		t.Errorf("Values of %q must be populated, got %+v", query, q.Values)
+	}
+
+	q, err = NewParser().ParseQuery(query)
+	if err != nil {
+		t.Fatalf("ParseQuery(%q) returned error %v", query, err)
+	}
+	if q.OrderedValues != nil {
+		t.Errorf("OrderedValues of %q must be nil by default, got %+v", query, q.OrderedValues)
+	}
+}
+
+type includeDelimitersTest struct {
+	relation rune
+	nested   rune
+	in       string
+	out      []Include
+}
+
+var includeDelimitersTests = []includeDelimitersTest{
+	{
+		relation: '+',
+		nested:   '.',
+		in:       "include=author%2Bcomments.author",
+		out: []Include{
+			{Relation: "author"},
+			{Relation: "comments", Includes: []Include{{Relation: "author"}}},
+		},
+	},
+	{
+		relation: ' ',
+		nested:   '/',
+		in:       "include=author+comments/author+comments/replies",
+		out: []Include{
+			{Relation: "author"},
+			{Relation: "comments", Includes: []Include{{Relation: "author"}, {Relation: "replies"}}},
+		},
+	},
+	{
+		relation: '・',
+		nested:   '→',
+		in:       "include=author・comments→author",
+		out: []Include{
+			{Relation: "author"},
+			{Relation: "comments", Includes: []Include{{Relation: "author"}}},
+		},
+	},
+	{
+		relation: '|',
+		nested:   '.',
+		in:       "include=a|b.c",
+		out: []Include{
+			{Relation: "a"},
+			{Relation: "b", Includes: []Include{{Relation: "c"}}},
+		},
+	},
+	{
+		relation: '|',
+		nested:   '.',
+		in:       "include=a,b.c",
+		out: []Include{
+			{Relation: "a,b", Includes: []Include{{Relation: "c"}}},
+		},
+	},
+	{
+		relation: ',',
+		nested:   ',',
+		in:       "include=a,b.c",
+		out: []Include{
+			{Relation: "a"},
+			{Relation: "b.c"},
+		},
+	},
+}
+
+type listDelimitersTest struct {
+	in     string
+	opts   []Option
+	sort   []Sort
+	fields ResourceFields
+}
+
+var listDelimitersTests = []listDelimitersTest{
+	{
+		in:     "sort=-createdAt|title&fields[articles]=title|-secret|body",
+		opts:   []Option{WithSortDelimiter('|'), WithFieldsDelimiter('|')},
+		sort:   []Sort{{FieldName: "createdAt", Order: OrderDesc, ExplicitOrder: true}, {FieldName: "title"}},
+		fields: ResourceFields{"articles": {"title", "body"}},
+	},
+	{
+		in:     "sort=a,b&fields[articles]=title,body",
+		opts:   []Option{WithSortDelimiter('|'), WithFieldsDelimiter('|')},
+		sort:   []Sort{{FieldName: "a,b"}},
+		fields: ResourceFields{"articles": {"title,body"}},
+	},
+	{
+		in:   "sort=title.nullslast.createdAt",
+		opts: []Option{WithSortDelimiter('.')},
+		sort: []Sort{{FieldName: "title"}, {FieldName: "nullslast"}, {FieldName: "createdAt"}},
+	},
+	{
+		in:   "sort=-a--b",
+		opts: []Option{WithSortDelimiter('-')},
+		sort: []Sort{{FieldName: "a"}, {FieldName: "b"}},
+	},
+}
+
+func TestParserListDelimiters(t *testing.T) {
+	for _, tt := range listDelimitersTests {
+		q, err := NewParser(tt.opts...).ParseQuery(tt.in)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) returned error %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(q.Sort, tt.sort) || !reflect.DeepEqual(q.Fields, tt.fields) {
+			t.Errorf("ParseQuery(%q):\n\tgot  %+v, %+v\n\twant %+v, %+v\n", tt.in, q.Sort, q.Fields, tt.sort, tt.fields)
+		}
+	}
+}
+
+func TestParserIncludeDelimiters(t *testing.T) {
+	for _, tt := range includeDelimitersTests {
+		q, err := NewParser(WithIncludeDelimiters(tt.relation, tt.nested)).ParseQuery(tt.in)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) returned error %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(q.Includes, tt.out) {
+			t.Errorf(
+				"ParseQuery(%q) with delimiters %q, %q:\n\tgot  %+v\n\twant %+v\n",
+				tt.in,
+				tt.relation,
+				tt.nested,
+				q.Includes,
+				tt.out,
+			)
+		}
+	}
+}
+
+type strictSeparatorsTest struct {
+	in          string
+	errContains string
+}
+
+var strictSeparatorsTests = []strictSeparatorsTest{
+	{in: ""},
+	{in: "?a=1&b=2;c=3"},
+	{in: "a=1&"},
+	{in: "&a=1"},
+	{in: "a=1&&b=2", errContains: "unexpected separator at position 4"},
+	{in: "?a=1;;b=2", errContains: "unexpected separator at position 4"},
+	{in: "key[property]=value&&&&&&;;;;;key[property]=value2", errContains: "unexpected separator at position 20"},
+}
+
+func TestParserStrictSeparators(t *testing.T) {
+	for _, tt := range strictSeparatorsTests {
+		_, err := NewParser(WithStrictSeparators(true)).ParseValues(tt.in)
+		if err != nil && tt.errContains == "" {
+			t.Errorf("ParseValues(%q) with strict separators returned unexpected error %s", tt.in, err)
+			continue
+		}
+		if err == nil && tt.errContains != "" {
+			t.Errorf(
+				"expected ParseValues(%q) with strict separators to return error which contains %q, but nil is returned",
+				tt.in,
+				tt.errContains,
+			)
+			continue
+		}
+		if err != nil && !strings.Contains(err.Error(), tt.errContains) {
+			t.Errorf(
+				`ParseValues(%q) with strict separators returned error %q, want something containing %q"`,
+				tt.in,
+				err,
+				tt.errContains,
+			)
+		}
+		if _, err := NewParser().ParseValues(tt.in); err != nil {
+			t.Errorf("ParseValues(%q) returned unexpected error %s", tt.in, err)
+		}
+	}
+}
+
+type sortFunctionsTest struct {
+	in  string
+	out []Sort
+}
+
+var sortFunctionsTests = []sortFunctionsTest{
+	{
+		in: "sort=length(title),-created",
+		out: []Sort{
+			{FieldName: "title", Func: "length", Order: OrderAsc},
+			{FieldName: "created", Order: OrderDesc, ExplicitOrder: true},
+		},
+	},
+	{
+		in: "sort=-lower(name).nullslast,name,lower(name)",
+		out: []Sort{
+			{FieldName: "name", Func: "lower", Order: OrderDesc, NullsOrder: NullsLast, ExplicitOrder: true},
+			{FieldName: "name", Order: OrderAsc},
+		},
+	},
+	{
+		in: "sort=length(),(title),f(g(x)),f(x)y",
+		out: []Sort{
+			{FieldName: "length()"},
+			{FieldName: "(title)"},
+			{FieldName: "f(g(x))"},
+			{FieldName: "f(x)y"},
+		},
+	},
+}
+
+func TestParserSortFunctions(t *testing.T) {
+	for _, tt := range sortFunctionsTests {
+		q, err := NewParser(WithSortFunctions(true)).ParseQuery(tt.in)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) returned error %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(q.Sort, tt.out) {
+			t.Errorf("ParseQuery(%q) with sort functions:\n\tgot  %+v\n\twant %+v\n", tt.in, q.Sort, tt.out)
+		}
+	}
+
+	const query = "sort=length(title)"
+	q, err := ParseQuery(query)
+	if err != nil {
+		t.Fatalf("ParseQuery(%q) returned error %v", query, err)
+	}
+	expected := []Sort{{FieldName: "length(title)"}}
+	if !reflect.DeepEqual(q.Sort, expected) {
+		t.Errorf("ParseQuery(%q):\n\tgot  %+v\n\twant %+v\n", query, q.Sort, expected)
+	}
+}
+
+type includeCaseTest struct {
+	mode IncludeCase
+	in   string
+	out  []Include
+}
+
+var includeCaseTests = []includeCaseTest{
+	{
+		mode: IncludeCaseSensitive,
+		in:   "include=Author,author",
+		out:  []Include{{Relation: "Author"}, {Relation: "author"}},
+	},
+	{
+		mode: IncludeCaseLower,
+		in:   "include=Author,author",
+		out:  []Include{{Relation: "author"}},
+	},
+	{
+		mode: IncludeCasePreserve,
+		in:   "include=Author,author",
+		out:  []Include{{Relation: "Author"}},
+	},
+	{
+		mode: IncludeCaseLower,
+		in:   "include=Comments.Author,comments.AUTHOR,COMMENTS.replies",
+		out: []Include{
+			{Relation: "comments", Includes: []Include{{Relation: "author"}, {Relation: "replies"}}},
+		},
+	},
+	{
+		mode: IncludeCasePreserve,
+		in:   "include=Comments.Author,comments.AUTHOR,COMMENTS.replies",
+		out: []Include{
+			{Relation: "Comments", Includes: []Include{{Relation: "Author"}, {Relation: "replies"}}},
+		},
+	},
+}
+
+func TestParserIncludeCase(t *testing.T) {
+	for _, tt := range includeCaseTests {
+		q, err := NewParser(WithIncludeCase(tt.mode)).ParseQuery(tt.in)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) returned error %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(q.Includes, tt.out) {
+			t.Errorf(
+				"ParseQuery(%q) with include case %d:\n\tgot  %+v\n\twant %+v\n",
+				tt.in,
+				tt.mode,
+				q.Includes,
+				tt.out,
+			)
+		}
+	}
+}
+
+func TestParserHooks(t *testing.T) {
+	var durations []time.Duration
+	var reasons []string
+	p := NewParser(
+		WithOnParse(func(dur time.Duration) {
+			durations = append(durations, dur)
+		}),
+		WithOnReject(func(reason string) {
+			reasons = append(reasons, reason)
+		}),
+	)
+
+	if _, err := p.ParseRequest("/articles?sort=title"); err != nil {
+		t.Fatalf("ParseRequest returned error %v", err)
+	}
+	if _, err := p.ParseQuery("sort=title"); err != nil {
+		t.Fatalf("ParseQuery returned error %v", err)
+	}
+	if _, err := p.ParseRequest("/"); err == nil {
+		t.Fatalf("ParseRequest(\"/\") returned nil error")
+	}
+	if _, err := p.ParsePathAndQuery("/articles", "page%zz"); err == nil {
+		t.Fatalf("ParsePathAndQuery with malformed query returned nil error")
+	}
+	if _, err := p.ParseQueryKeywords("sort=title", "sort"); err != nil {
+		t.Fatalf("ParseQueryKeywords returned error %v", err)
+	}
+	if _, err := p.ParseQueryFromURLValues(url.Values{"sort": {"title"}}); err != nil {
+		t.Fatalf("ParseQueryFromURLValues returned error %v", err)
+	}
+	if _, err := p.ParseHTTPRequest(httptest.NewRequest("GET", "/articles?sort=title", nil)); err != nil {
+		t.Fatalf("ParseHTTPRequest returned error %v", err)
+	}
+	if _, err := p.ParseHTTPRequest(nil); err == nil {
+		t.Fatalf("ParseHTTPRequest(nil) returned nil error")
+	}
+
+	if len(durations) != 8 {
+		t.Errorf("OnParse is invoked %d times, want 8", len(durations))
+	}
+	if len(reasons) != 3 {
+		t.Fatalf("OnReject is invoked %d times, want 3", len(reasons))
+	}
+	if !strings.Contains(reasons[2], "is nil") {
+		t.Errorf("OnReject received %q, want something containing %q", reasons[2], "is nil")
+	}
+	if !strings.Contains(reasons[0], "empty path") {
+		t.Errorf("OnReject received %q, want something containing %q", reasons[0], "empty path")
+	}
+
+	// no hooks
+	if _, err := NewParser().ParseRequest("/"); err == nil {
+		t.Errorf("ParseRequest(\"/\") returned nil error")
+	}
+}
+
+func TestParserMaxQueryLength(t *testing.T) {
+	p := NewParser(WithMaxQueryLength(10))
+	const short, long = "sort=title", "sort=title&"
+	if _, err := p.ParseValues(short); err != nil {
+		t.Errorf("ParseValues(%q) with max query length returned unexpected error %s", short, err)
+	}
+	if _, err := p.ParseValuesReader(strings.NewReader(short)); err != nil {
+		t.Errorf("ParseValuesReader(%q) with max query length returned unexpected error %s", short, err)
+	}
+	const expected = "qparser: query is too long, the maximum length is 10 bytes"
+	if _, err := p.ParseQuery(long); err == nil || err.Error() != expected {
+		t.Errorf("ParseQuery(%q) with max query length returned error %v, want %q", long, err, expected)
+	}
+	if _, err := p.ParseValuesReader(strings.NewReader(long)); err == nil || err.Error() != expected {
+		t.Errorf("ParseValuesReader(%q) with max query length returned error %v, want %q", long, err, expected)
+	}
+	if _, err := NewParser().ParseValues(long); err != nil {
+		t.Errorf("ParseValues(%q) returned unexpected error %s", long, err)
+	}
+}
+
+type havingTest struct {
+	in      string
+	keyword string
+	out     []Filter
+}
+
+var havingTests = []havingTest{
+	{
+		in:  "filter[status]=eq:paid&having[total]=gt:100&having[count]=gte:2",
+		out: []Filter{{FieldName: "total", Predicate: "gt:100", Op: "gt", Value: "100"}, {FieldName: "count", Predicate: "gte:2", Op: "gte", Value: "2"}},
+	},
+	{
+		in:  "having=gt:100&having[a][b]=1&having[total]=",
+		out: nil,
+	},
+	{
+		in:      "having[total]=gt:100&agg[total]=lt:10",
+		keyword: "agg",
+		out:     []Filter{{FieldName: "total", Predicate: "lt:10", Op: "lt", Value: "10"}},
+	},
+}
+
+func TestParserHavingKeyword(t *testing.T) {
+	for _, tt := range havingTests {
+		q, err := NewParser(WithHavingKeyword(tt.keyword)).ParseQuery(tt.in)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) returned unexpected error %s", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(q.Having, tt.out) {
+			t.Errorf("ParseQuery(%q) having:\n\tgot  %+v\n\twant %+v\n", tt.in, q.Having, tt.out)
+		}
+	}
+}
+
+type keywordOptionsTest struct {
+	in   string
+	opts []Option
+	out  *Query
+}
+
+var keywordOptionsTests = []keywordOptionsTest{
+	{
+		in:   "pagination[size]=10&page[size]=5",
+		opts: []Option{WithPageKeyword("pagination")},
+		out:  &Query{Page: &Page{Size: "10"}},
+	},
+	{
+		in:   "page[size]=5",
+		opts: []Option{WithPageKeyword("")},
+		out:  &Query{Page: &Page{Size: "5"}},
+	},
+	{
+		in:   "order=-createdAt&sort=title",
+		opts: []Option{WithSortKeyword("order")},
+		out:  &Query{Sort: []Sort{{FieldName: "createdAt", Order: OrderDesc, ExplicitOrder: true}}},
+	},
+	{
+		in:   "where[title]=eq:a&filter[title]=eq:b",
+		opts: []Option{WithFilterKeyword("where")},
+		out:  &Query{Filters: []Filter{{FieldName: "title", Predicate: "eq:a", Op: "eq", Value: "a"}}},
+	},
+	{
+		in:   "with=author&include=tags",
+		opts: []Option{WithIncludeKeyword("with")},
+		out:  &Query{Includes: []Include{{Relation: "author"}}},
+	},
+	{
+		in:   "only[articles]=title&fields[articles]=body",
+		opts: []Option{WithFieldsKeyword("only")},
+		out:  &Query{Fields: ResourceFields{"articles": {"title"}}},
+	},
+}
+
+func TestParseQueryWithOptions(t *testing.T) {
+	for _, tt := range keywordOptionsTests {
+		q, err := ParseQueryWithOptions(tt.in, tt.opts...)
+		if err != nil {
+			t.Errorf("ParseQueryWithOptions(%q) returned unexpected error %s", tt.in, err)
+			continue
+		}
+		if got := structured(q); !reflect.DeepEqual(got.Page, tt.out.Page) ||
+			!reflect.DeepEqual(got.Sort, tt.out.Sort) ||
+			!reflect.DeepEqual(got.Filters, tt.out.Filters) ||
+			!reflect.DeepEqual(got.Includes, tt.out.Includes) ||
+			!reflect.DeepEqual(got.Fields, tt.out.Fields) {
+			t.Errorf("ParseQueryWithOptions(%q):\n\tgot  %+v\n\twant %+v\n", tt.in, got, tt.out)
+		}
+	}
+
+	const query = "filter[title]=eq:a&page[size]=10&sort=-createdAt&include=author&fields[articles]=title"
+	q, err := ParseQuery(query)
+	if err != nil {
+		t.Fatalf("ParseQuery(%q) returned error %v", query, err)
+	}
+	withoutOptions, err := ParseQueryWithOptions(query)
+	if err != nil {
+		t.Fatalf("ParseQueryWithOptions(%q) returned error %v", query, err)
+	}
+	if !reflect.DeepEqual(withoutOptions, q) {
+		t.Errorf("ParseQueryWithOptions(%q) without options:\n\tgot  %+v\n\twant %+v\n", query, withoutOptions, q)
+	}
+
+	const request = "/articles?pagination[number]=2"
+	r, err := ParseRequestWithOptions(request, WithPageKeyword("pagination"))
+	if err != nil {
+		t.Fatalf("ParseRequestWithOptions(%q) returned error %v", request, err)
+	}
+	if r.Resource.Type != "articles" || r.Query.Page == nil || r.Query.Page.Number != "2" {
+		t.Errorf("ParseRequestWithOptions(%q) returned %+v, want the page number %q", request, r, "2")
+	}
+}
+
+func TestParserRawSegments(t *testing.T) {
+	const path = "//articles/a%2Fb%20c/relationships/comments"
+	r, err := NewParser(WithRawSegments(true)).ParsePathAndQuery(path, "")
+	if err != nil {
+		t.Fatalf("ParsePathAndQuery(%q) returned error %v", path, err)
+	}
+	expected := []string{"articles", "a%2Fb%20c", "relationships", "comments"}
+	if !reflect.DeepEqual(r.RawSegments, expected) {
+		t.Errorf("ParsePathAndQuery(%q) raw segments:\n\tgot  %+v\n\twant %+v\n", path, r.RawSegments, expected)
+	}
+	if r.Resource.ID != "a/b c" {
+		t.Errorf("ParsePathAndQuery(%q) resource id is %q, want %q", path, r.Resource.ID, "a/b c")
+	}
+
+	r, err = NewParser().ParsePathAndQuery(path, "")
+	if err != nil {
+		t.Fatalf("ParsePathAndQuery(%q) returned error %v", path, err)
+	}
+	if r.RawSegments != nil {
+		t.Errorf("ParsePathAndQuery(%q) raw segments are %+v, want nil when the option is disabled", path, r.RawSegments)
+	}
+}
+
+type nestedPathTest struct {
+	in          string
+	out         *Request
+	errContains string
+}
+
+var nestedPathTests = []nestedPathTest{
+	{
+		in: "/articles/1/relationships/comments",
+		out: &Request{
+			Resource:         Resource{Type: "articles", ID: "1"},
+			RelationshipType: "comments",
+		},
+	},
+	{
+		in: "/articles/1/comments/5",
+		out: &Request{
+			Resource:        Resource{Type: "articles", ID: "1"},
+			NestedResources: []Resource{{Type: "comments", ID: "5"}},
+		},
+	},
+	{
+		in: "/articles/1/comments/5/author",
+		out: &Request{
+			Resource:            Resource{Type: "articles", ID: "1"},
+			NestedResources:     []Resource{{Type: "comments", ID: "5"}},
+			RelatedResourceType: "author",
+		},
+	},
+	{
+		in: "/articles/1/comments/5/relationships/author",
+		out: &Request{
+			Resource:         Resource{Type: "articles", ID: "1"},
+			NestedResources:  []Resource{{Type: "comments", ID: "5"}},
+			RelationshipType: "author",
+		},
+	},
+	{
+		in: "/articles/1/comments/5/author/7/relationships/avatar",
+		out: &Request{
+			Resource:         Resource{Type: "articles", ID: "1"},
+			NestedResources:  []Resource{{Type: "comments", ID: "5"}, {Type: "author", ID: "7"}},
+			RelationshipType: "avatar",
+		},
+	},
+	{
+		in: "/articles/1/comments/5/author/7",
+		out: &Request{
+			Resource:        Resource{Type: "articles", ID: "1"},
+			NestedResources: []Resource{{Type: "comments", ID: "5"}, {Type: "author", ID: "7"}},
+		},
+	},
+	{
+		in:          "/articles/1/comments/5/relationships",
+		errContains: "followed by exactly one relationship name",
+	},
+	{
+		in:          "/articles/1/comments/5/relationships/author/extra",
+		errContains: "followed by exactly one relationship name",
+	},
+}
+
+func TestParserNestedPaths(t *testing.T) {
+	p := NewParser(WithNestedPaths(true))
+	for _, tt := range nestedPathTests {
+		r, err := p.ParsePathAndQuery(tt.in, "")
+		if err != nil && tt.errContains == "" {
+			t.Errorf("ParsePathAndQuery(%q) with nested paths returned unexpected error %s", tt.in, err)
+			continue
+		}
+		if err == nil && tt.errContains != "" {
+			t.Errorf(
+				"expected ParsePathAndQuery(%q) with nested paths to return error which contains %q, but nil is returned",
+				tt.in,
+				tt.errContains,
+			)
+			continue
+		}
+		if err != nil {
+			if !strings.Contains(err.Error(), tt.errContains) {
+				t.Errorf(
+					`ParsePathAndQuery(%q) with nested paths returned error %q, want something containing %q"`,
+					tt.in,
+					err,
+					tt.errContains,
+				)
+			}
+			continue
+		}
+		r.Query = nil
+		if !reflect.DeepEqual(r, tt.out) {
+			t.Errorf("ParsePathAndQuery(%q) with nested paths:\n\tgot  %+v\n\twant %+v\n", tt.in, r, tt.out)
+		}
+		u, err := r.URL()
+		if err != nil {
+			t.Errorf("Request%+v.URL() returned error %v", r, err)
+			continue
+		}
+		if u.Path != tt.in {
+			t.Errorf("Request%+v.URL() returned path %q, want %q", r, u.Path, tt.in)
+		}
+	}
+
+	const longPath = "/articles/1/comments/5/author"
+	if _, err := NewParser().ParsePathAndQuery(longPath, ""); err == nil {
+		t.Errorf("expected ParsePathAndQuery(%q) without nested paths to return error, but nil is returned", longPath)
+	}
+}
+
+type decodePlusInPathTest struct {
+	in      string
+	enabled bool
+	out     Resource
+}
+
+var decodePlusInPathTests = []decodePlusInPathTest{
+	{in: "/articles/hello+world", enabled: false, out: Resource{Type: "articles", ID: "hello+world"}},
+	{in: "/articles/hello+world", enabled: true, out: Resource{Type: "articles", ID: "hello world"}},
+	{in: "/articles/a%2Bb+c%20d", enabled: true, out: Resource{Type: "articles", ID: "a+b c d"}},
+	{in: "/articles/a%2Bb", enabled: false, out: Resource{Type: "articles", ID: "a+b"}},
+}
+
+func TestParserDecodePlusInPath(t *testing.T) {
+	for _, tt := range decodePlusInPathTests {
+		r, err := NewParser(WithDecodePlusInPath(tt.enabled)).ParsePathAndQuery(tt.in, "")
+		if err != nil {
+			t.Errorf("ParsePathAndQuery(%q) returned unexpected error %s", tt.in, err)
+			continue
+		}
+		if r.Resource != tt.out {
+			t.Errorf("ParsePathAndQuery(%q) with decoding %t:\n\tgot  %+v\n\twant %+v\n", tt.in, tt.enabled, r.Resource, tt.out)
+		}
+	}
+}
+
+type rawModeTest struct {
+	path     string
+	query    string
+	raw      bool
+	resource Resource
+	filters  []Filter
+}
+
+var rawModeTests = []rawModeTest{
+	{
+		path:     "/articles/a%2Fb",
+		query:    "filter[title]=100%25+sure",
+		raw:      false,
+		resource: Resource{Type: "articles", ID: "a/b"},
+		filters:  []Filter{{FieldName: "title", Predicate: "100% sure", Op: "", Value: "100% sure"}},
+	},
+	{
+		path:     "/articles/a%2Fb",
+		query:    "filter[title]=100%25+sure",
+		raw:      true,
+		resource: Resource{Type: "articles", ID: "a%2Fb"},
+		filters:  []Filter{{FieldName: "title", Predicate: "100%25+sure", Op: "", Value: "100%25+sure"}},
+	},
+	{
+		path:     "/articles/c++",
+		query:    "filter[title]=100% sure",
+		raw:      true,
+		resource: Resource{Type: "articles", ID: "c++"},
+		filters:  []Filter{{FieldName: "title", Predicate: "100% sure", Op: "", Value: "100% sure"}},
+	},
+	{
+		path:     "/articles/1",
+		query:    "filter[a%5Bb%5D]=%zz",
+		raw:      true,
+		resource: Resource{Type: "articles", ID: "1"},
+		filters:  []Filter{{FieldName: "a%5Bb%5D", Predicate: "%zz", Op: "", Value: "%zz"}},
+	},
+}
+
+func TestParserRawMode(t *testing.T) {
+	for _, tt := range rawModeTests {
+		r, err := NewParser(WithRawMode(tt.raw), WithDecodePlusInPath(true)).ParsePathAndQuery(tt.path, tt.query)
+		if err != nil {
+			t.Errorf("ParsePathAndQuery(%q, %q) returned unexpected error %s", tt.path, tt.query, err)
+			continue
+		}
+		if r.Resource != tt.resource {
+			t.Errorf("ParsePathAndQuery(%q) in raw mode %t:\n\tgot  %+v\n\twant %+v\n", tt.path, tt.raw, r.Resource, tt.resource)
+		}
+		if !reflect.DeepEqual(r.Query.Filters, tt.filters) {
+			t.Errorf("ParsePathAndQuery(%q) in raw mode %t:\n\tgot  %+v\n\twant %+v\n", tt.query, tt.raw, r.Query.Filters, tt.filters)
+		}
+	}
+}
+
+type utf8ModeTest struct {
+	in          string
+	mode        UTF8Mode
+	out         Values
+	errContains string
+}
+
+var utf8ModeTests = []utf8ModeTest{
+	{
+		in:   "name=a%FFb",
+		mode: UTF8Keep,
+		out:  Values{"name": {{TopLevelKey: "name", Value: "a\xffb"}}},
+	},
+	{
+		in:          "name=a%FF%FEb&%C3%A9t%C3%A9=%E2%82%AC",
+		mode:        UTF8Reject,
+		errContains: `value of the query param "name" is not a valid UTF-8 string`,
+	},
+	{
+		in:          "filter[na%C0me]=x",
+		mode:        UTF8Reject,
+		errContains: "is not a valid UTF-8 string",
+	},
+	{
+		in:   "%C3%A9t%C3%A9=%E2%82%AC",
+		mode: UTF8Reject,
+		out:  Values{"été": {{TopLevelKey: "été", Value: "€"}}},
+	},
+	{
+		in:   "name=a%FF%FEb&filter[na%C0me]=x",
+		mode: UTF8Replace,
+		out: Values{
+			"name":   {{TopLevelKey: "name", Value: "a\uFFFDb"}},
+			"filter": {{TopLevelKey: "filter", NestedKeys: []string{"na\uFFFDme"}, Value: "x"}},
+		},
+	},
+}
+
+func TestParserUTF8Mode(t *testing.T) {
+	for _, tt := range utf8ModeTests {
+		values, err := NewParser(WithUTF8Mode(tt.mode)).ParseValues(tt.in)
+		if tt.errContains != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.errContains) {
+				t.Errorf("ParseValues(%q) returned error %v, want something containing %q", tt.in, err, tt.errContains)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseValues(%q) returned unexpected error %s", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(values, tt.out) {
+			t.Errorf("ParseValues(%q) in UTF-8 mode %d:\n\tgot  %+v\n\twant %+v\n", tt.in, tt.mode, values, tt.out)
+		}
+	}
+}
+
+type requireFilterIncludesTest struct {
+	in          string
+	errContains string
+}
+
+var requireFilterIncludesTests = []requireFilterIncludesTest{
+	{in: "filter[title]=eq:a"},
+	{in: "filter[author.name]=eq:bob&include=author"},
+	{in: "filter[comments.author.name]=eq:bob&include=comments.author"},
+	{in: "filter[comments.body]=like:x&include=comments.author"},
+	{in: "filter[.name]=eq:bob"},
+	{
+		in:          "filter[author.name]=eq:bob",
+		errContains: `filter[author.name] requires the relation "author" to be included`,
+	},
+	{
+		in:          "filter[comments.author.name]=eq:bob&include=comments",
+		errContains: `filter[comments.author.name] requires the relation "comments.author" to be included`,
+	},
+}
+
+func TestParserRequireFilterIncludes(t *testing.T) {
+	p := NewParser(WithRequireFilterIncludes(true))
+	for _, tt := range requireFilterIncludesTests {
+		_, err := p.ParseQuery(tt.in)
+		if err != nil && tt.errContains == "" {
+			t.Errorf("ParseQuery(%q) with required filter includes returned unexpected error %s", tt.in, err)
+			continue
+		}
+		if err == nil && tt.errContains != "" {
+			t.Errorf(
+				"expected ParseQuery(%q) with required filter includes to return error which contains %q, but nil is returned",
+				tt.in,
+				tt.errContains,
+			)
+			continue
+		}
+		if err != nil && !strings.Contains(err.Error(), tt.errContains) {
+			t.Errorf(
+				`ParseQuery(%q) with required filter includes returned error %q, want something containing %q"`,
+				tt.in,
+				err,
+				tt.errContains,
+			)
+		}
+		if _, err := NewParser().ParseQuery(tt.in); err != nil {
+			t.Errorf("ParseQuery(%q) returned unexpected error %s", tt.in, err)
+		}
+	}
+
+	const query = "filter[Author.name]=eq:bob&include=author"
+	if _, err := NewParser(WithRequireFilterIncludes(true), WithIncludeCase(IncludeCaseLower)).ParseQuery(query); err != nil {
+		t.Errorf("ParseQuery(%q) with case-insensitive includes returned unexpected error %s", query, err)
+	}
+}
+
+type knownOperatorsTest struct {
+	in          string
+	errContains string
+}
+
+var knownOperatorsTests = []knownOperatorsTest{
+	{in: "filter[title]=eq:a&filter[createdAt]=lt:2020-01-02"},
+	{in: "filter[title]=plain&having[total]=gt:100"},
+	{in: "filter[d]=2020-01-01T10:00:00&filter[t]=10:30"},
+	{in: "filter[d]=eq:2020-01-01T10:00:00"},
+	{in: "filter[title]=not_in:a", errContains: `filter[title] operator "not_in" is not allowed`},
+	{in: "filter[title]=a1:b", errContains: `filter[title] operator "a1" is not allowed`},
+	{in: "filter[title]=like:a", errContains: `filter[title] operator "like" is not allowed, expected one of: eq, lt, gt`},
+	{in: "having[total]=gte:100", errContains: `having[total] operator "gte" is not allowed`},
+}
+
+func TestParserKnownOperators(t *testing.T) {
+	p := NewParser(WithKnownOperators("eq", "lt", "gt"))
+	for _, tt := range knownOperatorsTests {
+		_, err := p.ParseQuery(tt.in)
+		if err != nil && tt.errContains == "" {
+			t.Errorf("ParseQuery(%q) with known operators returned unexpected error %s", tt.in, err)
+			continue
+		}
+		if err == nil && tt.errContains != "" {
+			t.Errorf(
+				"expected ParseQuery(%q) with known operators to return error which contains %q, but nil is returned",
+				tt.in,
+				tt.errContains,
+			)
+			continue
+		}
+		if err != nil && !strings.Contains(err.Error(), tt.errContains) {
+			t.Errorf(
+				`ParseQuery(%q) with known operators returned error %q, want something containing %q"`,
+				tt.in,
+				err,
+				tt.errContains,
+			)
+		}
+		if _, err := NewParser().ParseQuery(tt.in); err != nil {
+			t.Errorf("ParseQuery(%q) returned unexpected error %s", tt.in, err)
+		}
+	}
+}
+
+type includeAliasesTest struct {
+	in      string
+	aliases []string
+	out     []Include
+}
+
+var includeAliasesTests = []includeAliasesTest{
+	{in: "expand=author", aliases: nil, out: nil},
+	{in: "expand=author", aliases: []string{"expand"}, out: []Include{{Relation: "author"}}},
+	{
+		in:      "expand=comments.author&include=tags,comments.likes",
+		aliases: []string{"expand"},
+		out: []Include{
+			{Relation: "tags"},
+			{Relation: "comments", Includes: []Include{{Relation: "likes"}, {Relation: "author"}}},
+		},
+	},
+	{
+		in:      "$expand=author&expand=tags",
+		aliases: []string{"expand", "$expand"},
+		out:     []Include{{Relation: "tags"}, {Relation: "author"}},
+	},
+	{in: "include=", aliases: []string{"expand"}, out: []Include{}},
+}
+
+func TestParserIncludeAliases(t *testing.T) {
+	for _, tt := range includeAliasesTests {
+		q, err := NewParser(WithIncludeAliases(tt.aliases...)).ParseQuery(tt.in)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) returned unexpected error %s", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(q.Includes, tt.out) {
+			t.Errorf("ParseQuery(%q) with include aliases %v:\n\tgot  %+v\n\twant %+v\n", tt.in, tt.aliases, q.Includes, tt.out)
+		}
+	}
+}
+
+type maxNestedKeysTest struct {
+	in          string
+	strict      bool
+	errContains string
+}
+
+var maxNestedKeysTests = []maxNestedKeysTest{
+	{in: "a[b][c]=1"},
+	{in: "a[b][c][d]=1", errContains: `too many nested keys of the query param "a", the maximum is 2`},
+	{in: "a[b][c][d]=1", strict: true, errContains: `too many nested keys of the query param "a", the maximum is 2`},
+	{in: "a[b][c][d" + strings.Repeat("][x", 10000) + "]=1", errContains: "too many nested keys"},
+	{in: "a[b]x[c][d][e]=1"},
+	{in: "a[b]x[c][d][e]=1", strict: true, errContains: "unexpected 'x'"},
+}
+
+func TestParserMaxNestedKeys(t *testing.T) {
+	for _, tt := range maxNestedKeysTests {
+		_, err := NewParser(WithMaxNestedKeys(2), WithStrict(tt.strict)).ParseValues(tt.in)
+		if err != nil && tt.errContains == "" {
+			t.Errorf("ParseValues(%q) with max nested keys returned unexpected error %s", tt.in, err)
+			continue
+		}
+		if err == nil && tt.errContains != "" {
+			t.Errorf(
+				"expected ParseValues(%q) with max nested keys to return error which contains %q, but nil is returned",
+				tt.in,
+				tt.errContains,
+			)
+			continue
+		}
+		if err != nil && !strings.Contains(err.Error(), tt.errContains) {
+			t.Errorf(
+				`ParseValues(%q) with max nested keys returned error %q, want something containing %q"`,
+				tt.in,
+				err,
+				tt.errContains,
+			)
+		}
+	}
+}
+
+type blankKeysTest struct {
+	in     string
+	reject bool
+	strict bool
+	out    Values
+	errPos int
+}
+
+var blankKeysTests = []blankKeysTest{
+	{
+		in:  "a=2&%20[%20]=1",
+		out: Values{" ": {{TopLevelKey: " ", NestedKeys: []string{" "}, Value: "1"}}, "a": {{TopLevelKey: "a", Value: "2"}}},
+	},
+	{
+		in:     "a=2&%20[%20]=1",
+		reject: true,
+		out:    Values{"a": {{TopLevelKey: "a", Value: "2"}}},
+	},
+	{
+		in:     "%20=1&=2&a=3",
+		reject: true,
+		out:    Values{"a": {{TopLevelKey: "a", Value: "3"}}},
+	},
+	{
+		in:     "filter[a][%20%20]=1&filter[b]=2",
+		reject: true,
+		out:    Values{"filter": {{TopLevelKey: "filter", NestedKeys: []string{"b"}, Value: "2"}}},
+	},
+	{
+		in:     "a=2&%20[%20]=1",
+		strict: true,
+		out:    Values{" ": {{TopLevelKey: " ", NestedKeys: []string{" "}, Value: "1"}}, "a": {{TopLevelKey: "a", Value: "2"}}},
+	},
+	{in: "%20[a]=1", reject: true, strict: true, errPos: 0},
+	{in: "filter[a][ ]=1", reject: true, strict: true, errPos: 10},
+	{in: "filter[\t]=1", reject: true, strict: true, errPos: 7},
+}
+
+func TestParserRejectBlankKeys(t *testing.T) {
+	for _, tt := range blankKeysTests {
+		values, err := NewParser(WithRejectBlankKeys(tt.reject), WithStrict(tt.strict)).ParseValues(tt.in)
+		if tt.out == nil {
+			syntaxErr, ok := err.(*KeySyntaxError)
+			if !ok {
+				t.Errorf("ParseValues(%q) returned error %v, want *KeySyntaxError", tt.in, err)
+				continue
+			}
+			if syntaxErr.Pos != tt.errPos {
+				t.Errorf("ParseValues(%q) returned error at position %d, want %d", tt.in, syntaxErr.Pos, tt.errPos)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseValues(%q) returned unexpected error %s", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(values, tt.out) {
+			t.Errorf("ParseValues(%q) rejecting blank keys %t:\n\tgot  %+v\n\twant %+v\n", tt.in, tt.reject, values, tt.out)
+		}
+	}
+}
+
+func TestSplitKeysEarlyExit(t *testing.T) {
+	key := "a" + strings.Repeat("[b]", 10000)
+	allocs := testing.AllocsPerRun(10, func() {
+		if _, _, err := splitKeys(key, 2); err == nil {
+			t.Fatalf("expected splitKeys(%q) to return error, but nil is returned", key[:10])
+		}
+	})
+	// the nested keys buffers, two nested keys and the error
+	if allocs > 8 {
+		t.Errorf("splitKeys() of a deeply bracketed key made %v allocations, the scanning must stop at the limit", allocs)
+	}
+}
+
+type pathSegmentsTest struct {
+	in          string
+	opts        []Option
+	errContains string
+}
+
+var pathSegmentsTests = []pathSegmentsTest{
+	{in: "/articles"},
+	{in: "/articles/1/relationships/comments"},
+	{in: "/articles/1/comments/5/author", errContains: "path has 5 segments, expected at most 4"},
+	{in: "/articles", opts: []Option{WithMinPathSegments(2)}, errContains: "path has 1 segments, expected at least 2"},
+	{in: "/articles/1", opts: []Option{WithMinPathSegments(2)}},
+	{in: "/articles/1/author", opts: []Option{WithMaxPathSegments(2)}, errContains: "expected at most 2"},
+	{in: "/articles/1/comments/5/author", opts: []Option{WithNestedPaths(true)}},
+	{
+		in:          "/articles/1/comments/5/author",
+		opts:        []Option{WithNestedPaths(true), WithMaxPathSegments(4)},
+		errContains: "path has 5 segments, expected at most 4",
+	},
+	{in: "/articles/1/comments/5/author", opts: []Option{WithMaxPathSegments(6)}, errContains: "unknown path format"},
+}
+
+func TestParserPathSegments(t *testing.T) {
+	for _, tt := range pathSegmentsTests {
+		_, err := NewParser(tt.opts...).ParsePathAndQuery(tt.in, "")
+		if err != nil && tt.errContains == "" {
+			t.Errorf("ParsePathAndQuery(%q) returned unexpected error %s", tt.in, err)
+			continue
+		}
+		if err == nil && tt.errContains != "" {
+			t.Errorf(
+				"expected ParsePathAndQuery(%q) to return error which contains %q, but nil is returned",
+				tt.in,
+				tt.errContains,
+			)
+			continue
+		}
+		if err != nil && !strings.Contains(err.Error(), tt.errContains) {
+			t.Errorf(
+				`ParsePathAndQuery(%q) returned error %q, want something containing %q"`,
+				tt.in,
+				err,
+				tt.errContains,
+			)
+		}
+	}
+}
+
+type versionSegmentTest struct {
+	in      string
+	pattern *regexp.Regexp
+	out     *Request
+}
+
+var versionSegmentTests = []versionSegmentTest{
+	{
+		in:  "/v1/articles/42",
+		out: &Request{Version: "v1", Resource: Resource{Type: "articles", ID: "42"}},
+	},
+	{
+		in:  "/v12/articles/42/relationships/comments",
+		out: &Request{Version: "v12", Resource: Resource{Type: "articles", ID: "42"}, RelationshipType: "comments"},
+	},
+	{
+		in:  "/articles/42",
+		out: &Request{Resource: Resource{Type: "articles", ID: "42"}},
+	},
+	{
+		in:  "/v1",
+		out: &Request{Resource: Resource{Type: "v1"}},
+	},
+	{
+		in:  "/version1/articles",
+		out: &Request{Resource: Resource{Type: "version1", ID: "articles"}},
+	},
+	{
+		in:      "/2021-01-01/articles",
+		pattern: regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`),
+		out:     &Request{Version: "2021-01-01", Resource: Resource{Type: "articles"}},
+	},
+}
+
+func TestParserVersionSegment(t *testing.T) {
+	for _, tt := range versionSegmentTests {
+		r, err := NewParser(WithVersionSegment(tt.pattern)).ParsePathAndQuery(tt.in, "")
+		if err != nil {
+			t.Errorf("ParsePathAndQuery(%q) with version segment returned unexpected error %s", tt.in, err)
+			continue
+		}
+		r.Query = nil
+		if !reflect.DeepEqual(r, tt.out) {
+			t.Errorf("ParsePathAndQuery(%q) with version segment:\n\tgot  %+v\n\twant %+v\n", tt.in, r, tt.out)
+		}
+		if u, err := r.URL(); err != nil || u.Path != tt.in {
+			t.Errorf("Request%+v.URL() returned %v, %v; want path %q", r, u, err, tt.in)
+		}
+	}
+
+	const path = "/v1/articles/42/relationships/comments"
+	if _, err := NewParser(WithVersionSegment(nil)).ParsePathAndQuery(path, ""); err != nil {
+		t.Errorf("ParsePathAndQuery(%q) with version segment returned unexpected error %s", path, err)
+	}
+	if _, err := NewParser().ParsePathAndQuery(path, ""); err == nil {
+		t.Errorf("expected ParsePathAndQuery(%q) without version segment to return error, but nil is returned", path)
+	}
+}
+
+type parseQueryKeywordsTest struct {
+	in       string
+	keywords []string
+	out      *Query
+}
+
+var parseQueryKeywordsTests = []parseQueryKeywordsTest{
+	{
+		in:       "page[size]=10&sort=-title&filter[a]=eq:1&include=author&fields[articles]=title&format=csv",
+		keywords: []string{"page"},
+		out:      &Query{Page: &Page{Size: "10"}},
+	},
+	{
+		in:       "page[size]=10&sort=-title&filter[a]=eq:1&include=author&fields[articles]=title&format=csv",
+		keywords: []string{"sort", "include", "format"},
+		out: &Query{
+			Sort:     []Sort{{FieldName: "title", Order: OrderDesc, ExplicitOrder: true}},
+			Includes: []Include{{Relation: "author"}},
+			Format:   "csv",
+		},
+	},
+	{
+		in:       "page[size]=10&sort=-title&filter[a]=eq:1&include=author&fields[articles]=title,-secret",
+		keywords: []string{"filter", "fields"},
+		out: &Query{
+			Filters:        []Filter{{FieldName: "a", Predicate: "eq:1", Op: "eq", Value: "1"}},
+			Fields:         ResourceFields{"articles": {"title"}},
+			ExcludedFields: ResourceFields{"articles": {"secret"}},
+		},
+	},
+	{
+		in:       "page[size]=10&sort=-title",
+		keywords: []string{"unknown"},
+		out:      &Query{},
+	},
+	{
+		in:  "page[size]=10&sort=-title",
+		out: &Query{},
+	},
+}
+
+func TestParseQueryKeywords(t *testing.T) {
+	for _, tt := range parseQueryKeywordsTests {
+		q, err := ParseQueryKeywords(tt.in, tt.keywords...)
+		if err != nil {
+			t.Errorf("ParseQueryKeywords(%q, %q) returned error %v", tt.in, tt.keywords, err)
+			continue
+		}
+		values, err := ParseValues(tt.in)
+		if err != nil {
+			t.Fatalf("ParseValues(%q) returned error %v", tt.in, err)
+		}
+		if !reflect.DeepEqual(q.Values, values) {
+			t.Errorf("ParseQueryKeywords(%q, %q) Values:\n\tgot  %+v\n\twant %+v\n", tt.in, tt.keywords, q.Values, values)
+		}
+		q.Values = nil
+		if !reflect.DeepEqual(q, tt.out) {
+			t.Errorf("ParseQueryKeywords(%q, %q):\n\tgot  %+v\n\twant %+v\n", tt.in, tt.keywords, q, tt.out)
+		}
+	}
+}
+
+func TestParseQueryKeywordsOptions(t *testing.T) {
+	p := NewParser(WithHavingKeyword("aggr"), WithKnownOperators("eq", "gt"))
+	q, err := p.ParseQueryKeywords("aggr[count]=gt:1&filter[a]=unknown:1", "aggr")
+	if err != nil {
+		t.Fatalf("ParseQueryKeywords() returned error %v", err)
+	}
+	expected := []Filter{{FieldName: "count", Predicate: "gt:1", Op: "gt", Value: "1"}}
+	if !reflect.DeepEqual(q.Having, expected) || q.Filters != nil {
+		t.Errorf("ParseQueryKeywords() Having %+v, Filters %+v; want %+v, nil", q.Having, q.Filters, expected)
+	}
+	if _, err := p.ParseQueryKeywords("filter[a]=unknown:1", "filter"); err == nil {
+		t.Errorf("ParseQueryKeywords() expected to return an error for the unknown operator")
+	}
+
+	// the include alias requests the merged includes
+	p = NewParser(WithIncludeAliases("with"))
+	q, err = p.ParseQueryKeywords("with=author&include=tags&sort=title", "with")
+	if err != nil {
+		t.Fatalf("ParseQueryKeywords() returned error %v", err)
+	}
+	includes := []Include{{Relation: "tags"}, {Relation: "author"}}
+	if !IncludesEqual(q.Includes, includes) || q.Sort != nil {
+		t.Errorf("ParseQueryKeywords() Includes %+v, Sort %+v; want %+v, nil", q.Includes, q.Sort, includes)
+	}
+
+	// the soft deletion flags are read separately
+	trashTests := []struct {
+		keywords       []string
+		includeDeleted bool
+		scope          TrashScope
+	}{
+		{keywords: []string{"onlyTrashed"}, includeDeleted: false, scope: TrashScopeDefault},
+		{keywords: []string{"withTrashed"}, includeDeleted: true, scope: TrashScopeWith},
+		{keywords: []string{"withTrashed", "onlyTrashed"}, includeDeleted: true, scope: TrashScopeWith},
+	}
+	for _, tt := range trashTests {
+		const in = "withTrashed=true&onlyTrashed=false"
+		q, err := ParseQueryKeywords(in, tt.keywords...)
+		if err != nil {
+			t.Fatalf("ParseQueryKeywords(%q, %q) returned error %v", in, tt.keywords, err)
+		}
+		if q.IncludeDeleted != tt.includeDeleted || q.TrashScope != tt.scope {
+			t.Errorf(
+				"ParseQueryKeywords(%q, %q) IncludeDeleted %t, TrashScope %v; want %t, %v",
+				in, tt.keywords, q.IncludeDeleted, q.TrashScope, tt.includeDeleted, tt.scope,
+			)
+		}
+	}
+	q, err = ParseQueryKeywords("withTrashed=true&onlyTrashed=true", "onlyTrashed")
+	if err != nil || q.IncludeDeleted || q.TrashScope != TrashScopeOnly {
+		t.Errorf("ParseQueryKeywords() returned %+v, %v; want only trashed scope", q, err)
+	}
+}
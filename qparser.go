@@ -1,10 +1,15 @@
 package qparser
 
 import (
-	"errors"
+	"bufio"
 	"fmt"
+	"io"
+	"net/http"
 	"net/url"
+	"sort"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 // Resource determines the requested resource or the type of the resource
@@ -16,6 +21,8 @@ type Resource struct {
 
 // ResourceFields contains a list of requested fields for the resources
 // 'fields[articles]=title,body' = ResourceFields{"articles": {"title", "body"}}
+// 'fields[articles]=' = ResourceFields{"articles": {}} which means no fields according to JSON:API
+// a key may be a dot separated relation path 'fields[comments.author]=name', see FieldsByPath
 type ResourceFields map[string][]string
 
 // FieldsByResource retrieves a list of fields by the given resource
@@ -28,12 +35,71 @@ func (r ResourceFields) FieldsByResource(resource string) (fields []string, ok b
 	return
 }
 
+// FieldsByPath retrieves the fieldset of the included relation by its dot separated path relative to the primary
+// resource e.g. 'fields[comments.author]=name' is the fieldset of the "comments.author" include,
+// the fieldset of the resource type of the relation is used if there is no fieldset keyed by the path,
+// the second return value indicates if any of them is set
+func (r ResourceFields) FieldsByPath(path, resourceType string) (fields []string, ok bool) {
+	if isRelationPath(path) {
+		if fields, ok = r.FieldsByResource(path); ok {
+			return fields, ok
+		}
+	}
+	return r.FieldsByResource(resourceType)
+}
+
+// isRelationPath reports whether the fieldset key is a dot separated relation path rather than a resource type
+func isRelationPath(key string) bool {
+	return strings.IndexByte(key, nestedRelationDelimiter) > 0
+}
+
+// IsRequested reports whether the field of the resource should be returned, that is the case if all fields
+// are requested (see AllRequested) or the fieldset contains the field, the explicitly empty fieldset
+// 'fields[articles]=' requests no fields, so false is returned for any field
+func (r ResourceFields) IsRequested(resource, field string) bool {
+	if r.AllRequested(resource) {
+		return true
+	}
+	for _, f := range r[resource] {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// NoneRequested reports whether the fieldset of the resource is explicitly empty 'fields[articles]='
+func (r ResourceFields) NoneRequested(resource string) bool {
+	fields, ok := r.FieldsByResource(resource)
+	return ok && len(fields) == 0
+}
+
+// AllRequested reports whether all fields of the resource should be returned, that is the case
+// if there is no fieldset for the resource or the fieldset contains the wildcard 'fields[articles]=*'
+// the wildcard can be combined with the explicit fieldsets of other resources
+func (r ResourceFields) AllRequested(resource string) bool {
+	fields, ok := r.FieldsByResource(resource)
+	if !ok {
+		return true
+	}
+	for _, field := range fields {
+		if field == fieldsWildcard {
+			return true
+		}
+	}
+	return false
+}
+
 // Filter specifies field name to apply filtering to,
 // a predicate expressed in textual form, the package does not know specific filtering syntax
-// 'filter[createdAt]=lt:2015-01-01' = Filter{FieldName: "createdAt", Predicate: "lt:2015-01-01"}
+// 'filter[createdAt]=lt:2015-01-01' = Filter{FieldName: "createdAt", Predicate: "lt:2015-01-01", Op: "lt", Value: "2015-01-01"}
+// Op and Value are the predicate split by the Operator method, they are populated by the parser,
+// the raw Predicate is kept and is the source of truth for the methods of the filter
 type Filter struct {
 	FieldName string
 	Predicate string
+	Op        string
+	Value     string
 }
 
 // Include determines resources that should be included in a response
@@ -46,12 +112,23 @@ type Include struct {
 // Page is pagination parameters
 // 'page[size]=10&page[number]=2' = Page{Size: "10", Number: "2"}
 // limit, offset, cursor are populated as well, the package is unaware of the pagination implementation
+// from, to define a range of values e.g. 'page[from]=2020-01-01&page[to]=2020-02-01', they are opaque strings
+// which are interpreted by the caller
+// CursorDirection is the keyset pagination direction relative to the cursor e.g. 'page[cursor]=abc&page[direction]=prev',
+// it is either CursorNext, CursorPrev or empty if the direction is not given
 type Page struct {
 	Size   string
 	Number string
 	Limit  string
 	Offset string
 	Cursor string
+	From   string
+	To     string
+
+	CursorDirection string
+
+	unbounded bool
+	maxValue  int
 }
 
 type SortOrder int
@@ -68,26 +145,173 @@ const (
 	OrderDesc
 )
 
+// NullsOrder determines the position of null values in the sorted list
+type NullsOrder int
+
+func (n NullsOrder) String() string {
+	switch n {
+	case NullsFirst:
+		return "NULLS FIRST"
+	case NullsLast:
+		return "NULLS LAST"
+	}
+	return ""
+}
+
+const (
+	NullsDefault NullsOrder = iota
+	NullsFirst
+	NullsLast
+)
+
+// TrashScope determines which records are requested with regard to the soft deletion
+type TrashScope int
+
+func (t TrashScope) String() string {
+	switch t {
+	case TrashScopeWith:
+		return "WITH TRASHED"
+	case TrashScopeOnly:
+		return "ONLY TRASHED"
+	}
+	return ""
+}
+
+const (
+	// TrashScopeDefault excludes the soft-deleted records
+	TrashScopeDefault TrashScope = iota
+	// TrashScopeWith includes the soft-deleted records e.g. 'withTrashed'
+	TrashScopeWith
+	// TrashScopeOnly requests only the soft-deleted records e.g. 'onlyTrashed'
+	TrashScopeOnly
+)
+
+const (
+	// CursorNext requests the records which follow the cursor
+	CursorNext = "next"
+	// CursorPrev requests the records which precede the cursor
+	CursorPrev = "prev"
+)
+
 // Sort indicates the field by which the sorting should be performed and the sorting direction
+// NullsOrder is set if the field name has the ".nullsfirst" or ".nullslast" suffix
+// 'sort=-createdAt.nullslast' = Sort{FieldName: "createdAt", Order: OrderDesc, NullsOrder: NullsLast}
+// Func is set if the sort functions are enabled and the field is given in the function call form
+// 'sort=length(title)' = Sort{FieldName: "title", Func: "length"}
+// ExplicitOrder is set if the direction is given by the field prefix, such fields are not affected by
+// the default direction of the order keyword (see WithOrderKeyword)
 type Sort struct {
-	FieldName string
-	Order     SortOrder
+	FieldName     string
+	Func          string
+	Order         SortOrder
+	NullsOrder    NullsOrder
+	ExplicitOrder bool
 }
 
 // Request represents the result of parsing the path and query string
+// Version is the leading API version segment e.g. '/v1/articles' = Request{Version: "v1"}, it is recognized only if
+// the WithVersionSegment option is enabled
+// NestedResources contains the related resources between the primary resource and the terminal related resource type
+// or relationship, it is populated only if the WithNestedPaths option is enabled
+// e.g. '/articles/1/comments/5/relationships/author' results in the "comments" resource with ID "5"
+// RawSegments contains the original escaped path segments, it is populated only if
+// the WithRawSegments option is enabled e.g. '/files/a%2Fb' = Request{RawSegments: []string{"files", "a%2Fb"}}
 type Request struct {
+	Version             string
 	Resource            Resource
+	NestedResources     []Resource
 	RelationshipType    string
 	RelatedResourceType string
+	RawSegments         []string
 	Query               *Query
 }
 
+// IsRelationshipRequest reports whether the relationship linkage is requested e.g. "/articles/1/relationships/author"
 func (r *Request) IsRelationshipRequest() bool {
-	return r.RelatedResourceType != ""
+	return r != nil && r.RelationshipType != ""
 }
 
+// IsRelatedResourceRequest reports whether the related resource is requested e.g. "/articles/1/author"
 func (r *Request) IsRelatedResourceRequest() bool {
-	return r.RelatedResourceType != ""
+	return r != nil && r.RelatedResourceType != ""
+}
+
+// RelationshipName returns the name of the relationship whose linkage is requested
+// e.g. "comments" for "/articles/1/relationships/comments", it is empty for the other requests
+func (r *Request) RelationshipName() string {
+	if !r.IsRelationshipRequest() {
+		return ""
+	}
+	return r.RelationshipType
+}
+
+// RelatedResourceName returns the name of the relation whose resources are requested
+// e.g. "comments" for "/articles/1/comments", it is empty for the other requests
+func (r *Request) RelatedResourceName() string {
+	if !r.IsRelatedResourceRequest() {
+		return ""
+	}
+	return r.RelatedResourceType
+}
+
+// primaryDataType returns the name of the type of the primary data, i.e. the relation name
+// of the related resource or relationship request, the resource type otherwise
+func (r *Request) primaryDataType() string {
+	switch {
+	case r.RelatedResourceType != "":
+		return r.RelatedResourceType
+	case r.RelationshipType != "":
+		return r.RelationshipType
+	}
+	return r.Resource.Type
+}
+
+// ReferencedTypes returns the distinct resource types mentioned by the request: the primary resource type,
+// the types of the nested resources, the related resource type and the relationship, the included relations
+// and the resources of the fieldsets, in that order, the fieldsets resources are sorted
+// note that the included relations and the relationship are the relation names rather than the types,
+// so the result is a best-effort set, see Query.ResolvedFields which maps the include paths to the types
+func (r *Request) ReferencedTypes() []string {
+	if r == nil {
+		return nil
+	}
+	var types []string
+	seen := make(map[string]struct{})
+	add := func(typ string) {
+		if typ == "" {
+			return
+		}
+		if _, exist := seen[typ]; exist {
+			return
+		}
+		seen[typ] = struct{}{}
+		types = append(types, typ)
+	}
+	add(r.Resource.Type)
+	for _, nested := range r.NestedResources {
+		add(nested.Type)
+	}
+	add(r.RelatedResourceType)
+	add(r.RelationshipType)
+	if r.Query == nil {
+		return types
+	}
+	for _, path := range includePaths(r.Query.Includes) {
+		_, relation := lastRelation(path)
+		add(relation)
+	}
+	resources := make([]string, 0, len(r.Query.Fields)+len(r.Query.ExcludedFields))
+	for resource := range r.Query.Fields {
+		resources = append(resources, resource)
+	}
+	for resource := range r.Query.ExcludedFields {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+	for _, resource := range resources {
+		add(resource)
+	}
+	return types
 }
 
 // Value represents the value from the query string
@@ -142,18 +366,179 @@ func (v Values) Get(topKey string, nestedKeys ...string) string {
 	return val
 }
 
+// GetAll retrieves all values associated with the top key which have exactly the given nested keys
+// in the order of appearance e.g. "filter[tag]=a&filter[tag]=b" results in []string{"a", "b"} for "filter", "tag",
+// an empty slice is returned if there are no such values
+func (v Values) GetAll(topKey string, nestedKeys ...string) []string {
+	list := matchingValues(v, topKey, nestedKeys...)
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
+
+// NestedPaths returns the nested keys of every value of the top key in the order of appearance
+// e.g. "filter[a]=1&filter[b][c]=2" results in [][]string{{"a"}, {"b", "c"}} for the "filter" top key,
+// the values without nested keys are skipped, the slices are copies, nil is returned if there are no nested keys
+func (v Values) NestedPaths(topKey string) [][]string {
+	var paths [][]string
+	for _, val := range v[topKey] {
+		if len(val.NestedKeys) == 0 {
+			continue
+		}
+		paths = append(paths, append([]string(nil), val.NestedKeys...))
+	}
+	return paths
+}
+
+// Bool interprets the first value associated with the top key which contains all the nested keys as a boolean flag
+// the key set to an empty value ("flag" or "flag=") is true, "1", "true", "yes" are true, "0", "false", "no" are false,
+// any other value results in an error, absent key is false
+func (v Values) Bool(topKey string, nestedKeys ...string) (bool, error) {
+	val, ok := v.GetExist(topKey, nestedKeys...)
+	if !ok {
+		return false, nil
+	}
+	b, ok := parseBool(val)
+	if !ok {
+		return false, wrapError(ErrInvalidValue, "qparser: %s %q is not a boolean value", valueKey(topKey, nestedKeys...), val)
+	}
+	return b, nil
+}
+
+// parseBool interprets the value as a boolean flag, see Values.Bool, the second return value is false
+// if the value is not a boolean
+func parseBool(val string) (bool, bool) {
+	switch val {
+	case "", "1", "true", "yes":
+		return true, true
+	case "0", "false", "no":
+		return false, true
+	}
+	return false, false
+}
+
+// Clone returns a deep copy of the values, the lists of values and the nested keys are copied as well,
+// so the copy can be modified without affecting the original, nil values result in nil
+func (v Values) Clone() Values {
+	if v == nil {
+		return nil
+	}
+	clone := make(Values, len(v))
+	for topKey, list := range v {
+		if list == nil {
+			clone[topKey] = nil
+			continue
+		}
+		copied := make([]Value, len(list))
+		for i, val := range list {
+			copied[i] = val
+			if val.NestedKeys != nil {
+				copied[i].NestedKeys = append(make([]string, 0, len(val.NestedKeys)), val.NestedKeys...)
+			}
+		}
+		clone[topKey] = copied
+	}
+	return clone
+}
+
 // Query contains all parameters read from the query string
+// ExcludedFields contains the fields prefixed by the '-' char, which should not be present in a response
+// ExcludedIncludes contains the include paths prefixed by the '-' char e.g. 'include=-comments.likes', which should
+// not be included even if they are included by default, see initExcludedIncludes
+// Having contains the filters of the aggregated values e.g. 'having[total]=gt:100', see Filter
+// Counts contains the relations whose counts are requested e.g. 'counts=comments' = Query{Counts: []string{"comments"}},
+// the counts are independent of the includes, a relation can be counted without being included
+// Profiles contains the URIs of the applied JSON:API profiles e.g. 'profile=https://example.com/timestamps'
+// IDs contains the ids of the resources requested in bulk e.g. 'ids=1,2' or 'ids[]=1&ids[]=2'
+// Format is the requested response format e.g. 'format=csv' = Query{Format: "csv"}
+// Locale is the requested BCP 47 language tag e.g. 'locale=en-US' = Query{Locale: "en-US"}
+// RequestID is the correlation id passed through the query e.g. 'requestId=abc' = Query{RequestID: "abc"}
+// IncludeDeleted indicates that soft-deleted records are requested e.g. 'withTrashed' = Query{IncludeDeleted: true}
+// TrashScope extends IncludeDeleted with the request of only soft-deleted records
+// e.g. 'onlyTrashed' = Query{TrashScope: TrashScopeOnly}, the 'onlyTrashed' flag takes precedence
+// OrderedValues contains every parsed value in the order of appearance, it is populated only if
+// the WithOrderedValues option is enabled, the Values map is populated regardless
+// Extensions contains arbitrary data attached by the custom keyword handlers or a middleware, it is not populated
+// by the built-in parsing, see SetExtension and GetExtension
 type Query struct {
-	Includes []Include
-	Fields   ResourceFields
-	Sort     []Sort
-	Filters  []Filter
-	Page     *Page
-	Values   Values
+	Includes         []Include
+	ExcludedIncludes []Include
+	Fields           ResourceFields
+	ExcludedFields   ResourceFields
+	Sort             []Sort
+	Filters          []Filter
+	Having           []Filter
+	Counts           []string
+	Profiles         []string
+	IDs              []string
+	Page             *Page
+	Format           string
+	Locale           string
+	RequestID        string
+	IncludeDeleted   bool
+	TrashScope       TrashScope
+	Values           Values
+	OrderedValues    []Value
+	Extensions       map[string]interface{}
+
+	syntax *querySyntax
+}
+
+// SetExtension attaches the value to the query by the key, the Extensions map is initialized if it is nil
+// nothing is attached to the nil query
+func (q *Query) SetExtension(key string, value interface{}) {
+	if q == nil {
+		return
+	}
+	if q.Extensions == nil {
+		q.Extensions = make(map[string]interface{})
+	}
+	q.Extensions[key] = value
+}
+
+// GetExtension retrieves the value attached by the key, the second return value indicates whether the value is set
+func (q *Query) GetExtension(key string) (interface{}, bool) {
+	if q == nil {
+		return nil, false
+	}
+	value, ok := q.Extensions[key]
+	return value, ok
+}
+
+// IsEmpty reports whether the query has no parsed parameters, the raw Values are not taken into account
+// as well as the Locale since it can be set by default and the RequestID since it does not affect the result
+// nil query is empty
+func (q *Query) IsEmpty() bool {
+	if q == nil {
+		return true
+	}
+	return len(q.Includes) == 0 &&
+		len(q.ExcludedIncludes) == 0 &&
+		len(q.Fields) == 0 &&
+		len(q.ExcludedFields) == 0 &&
+		len(q.Sort) == 0 &&
+		len(q.Filters) == 0 &&
+		len(q.Having) == 0 &&
+		len(q.Counts) == 0 &&
+		len(q.Profiles) == 0 &&
+		len(q.IDs) == 0 &&
+		q.Page == nil &&
+		q.Format == "" &&
+		!q.IncludeDeleted &&
+		q.TrashScope == TrashScopeDefault
+}
+
+// HasAnyParam reports whether the query string contains any params, unlike IsEmpty it takes into account
+// the raw Values, so the params which are not recognized by the parser count as well
+// nil query has no params
+func (q *Query) HasAnyParam() bool {
+	return q != nil && len(q.Values) > 0
 }
 
 const (
 	relationshipsRequest = "relationships"
+	byteOrderMark        = "\uFEFF"
 )
 
 // ParseValues parses a string and returns a structure filled with the corresponding values
@@ -162,48 +547,228 @@ const (
 // interpreted as a key set to an empty value.
 // Query can contain nested keys, which are defined by square brackets,
 // for example: page[size], page[number]
+//
+// A leading UTF-8 byte order mark and surrounding whitespace are removed before parsing.
 func ParseValues(query string) (Values, error) {
-	values := make(Values)
-	if query != "" && query[0] == '?' {
-		query = query[1:]
+	return defaultParser.ParseValues(query)
+}
+
+// parseValues parses the query into the values map, the second return value is the list of all values
+// in the order of appearance, it is populated only if the ordered values option is enabled
+func parseValues(query string, opts *options) (Values, []Value, error) {
+	if opts.maxQueryLength > 0 && len(query) > opts.maxQueryLength {
+		return nil, nil, errQueryTooLong(opts.maxQueryLength)
 	}
+	b := newValuesBuilder(opts)
+	query = strings.TrimRightFunc(trimQueryPrefix(query), unicode.IsSpace)
+	length := len(query)
 	for query != "" {
 		key := query
+		separated := false
 		if i := strings.IndexAny(key, "&;"); i >= 0 {
 			key, query = key[:i], key[i+1:]
+			separated = true
 		} else {
 			query = ""
 		}
-		if key == "" {
-			continue
+		if err := b.add(key, separated, length-len(query)-1); err != nil {
+			return nil, nil, err
 		}
-		value := ""
-		if i := strings.Index(key, "="); i >= 0 {
-			key, value = key[:i], key[i+1:]
+	}
+	return b.values, b.ordered, nil
+}
+
+// trimQueryPrefix removes the leading whitespace, the byte order mark and the question mark
+func trimQueryPrefix(query string) string {
+	query = strings.TrimLeftFunc(strings.TrimPrefix(strings.TrimLeftFunc(query, unicode.IsSpace), byteOrderMark), unicode.IsSpace)
+	if query != "" && query[0] == '?' {
+		query = query[1:]
+	}
+	return query
+}
+
+func errQueryTooLong(max int) error {
+	return wrapError(ErrQueryTooLong, "qparser: query is too long, the maximum length is %d bytes", max)
+}
+
+// valuesBuilder accumulates the key=value settings of a query
+type valuesBuilder struct {
+	opts           *options
+	values         Values
+	ordered        []Value
+	afterSeparator bool
+}
+
+func newValuesBuilder(opts *options) *valuesBuilder {
+	return &valuesBuilder{opts: opts, values: make(Values)}
+}
+
+// add parses the key=value setting, separated tells whether the setting is followed by a separator
+// and pos is the position of the separator in the query
+func (b *valuesBuilder) add(setting string, separated bool, pos int) error {
+	if setting == "" {
+		if b.opts.strictSeparators && b.afterSeparator && separated {
+			return wrapError(ErrMalformedQuery, "qparser: unexpected separator at position %d, query params must not be empty", pos)
 		}
+		b.afterSeparator = separated
+		return nil
+	}
+	b.afterSeparator = separated
+	key := setting
+	value := ""
+	if i := strings.Index(key, "="); i >= 0 {
+		key, value = key[:i], key[i+1:]
+	}
 
-		key, err := url.QueryUnescape(key)
+	if !b.opts.rawMode {
+		var err error
+		key, err = url.QueryUnescape(key)
 		if err != nil {
-			return nil, fmt.Errorf("qparser: failed to unescape query param name: %s", err.Error())
+			return wrapError(ErrMalformedQuery, "qparser: failed to unescape query param name: %s", err.Error())
 		}
 
-		value, _ = url.QueryUnescape(value)
+		value, err = url.QueryUnescape(value)
 		if err != nil {
-			return nil, fmt.Errorf("qparser: failed to unescape query param value: %s", err.Error())
+			return wrapError(ErrMalformedQuery, "qparser: failed to unescape query param value: %s", err.Error())
 		}
+	}
+	return b.addDecoded(key, value)
+}
 
-		topKey, nestedKeys := extractKeys(key)
-		kv := Value{
-			TopLevelKey: topKey,
-			NestedKeys:  nestedKeys,
-			Value:       value,
+// addDecoded adds the already unescaped key and value
+func (b *valuesBuilder) addDecoded(key, value string) error {
+	switch b.opts.utf8Mode {
+	case UTF8Reject:
+		if !utf8.ValidString(key) {
+			return wrapError(ErrMalformedQuery, "qparser: query param name %q is not a valid UTF-8 string", key)
 		}
-		if _, ok := values[topKey]; !ok {
-			values[topKey] = make([]Value, 0)
+		if !utf8.ValidString(value) {
+			return wrapError(ErrMalformedQuery, "qparser: value of the query param %q is not a valid UTF-8 string", key)
 		}
-		values[topKey] = append(values[topKey], kv)
+	case UTF8Replace:
+		key = strings.ToValidUTF8(key, string(utf8.RuneError))
+		value = strings.ToValidUTF8(value, string(utf8.RuneError))
+	}
+
+	topKey, nestedKeys, err := splitKeys(key, b.opts.maxNestedKeys)
+	if err != nil {
+		// a syntax violation is tolerated unless the strict mode is enabled, the limit violation is not,
+		// the list key such as "ids[]" is kept as the top-level key in the strict mode too
+		if _, syntax := err.(*KeySyntaxError); !syntax || b.opts.strict && !isListKey(key) {
+			return err
+		}
+		if topKey == "" {
+			topKey, nestedKeys = key, nil
+		}
+	}
+	if b.opts.rejectBlankKeys {
+		if err := checkBlankKeys(key, topKey, nestedKeys); err != nil {
+			if b.opts.strict {
+				return err
+			}
+			return nil
+		}
+	}
+	kv := Value{
+		TopLevelKey: topKey,
+		NestedKeys:  nestedKeys,
+		Value:       value,
+	}
+	if _, ok := b.values[topKey]; !ok {
+		b.values[topKey] = make([]Value, 0)
+	}
+	if b.opts.maxValuesPerKey > 0 && len(b.values[topKey]) >= b.opts.maxValuesPerKey {
+		return wrapError(
+			ErrLimitExceeded,
+			"qparser: too many values of the query param %q, the maximum is %d",
+			topKey,
+			b.opts.maxValuesPerKey,
+		)
+	}
+	b.values[topKey] = append(b.values[topKey], kv)
+	if b.opts.orderedValues {
+		b.ordered = append(b.ordered, kv)
+	}
+	return nil
+}
+
+// FromURLValues converts the url.Values e.g. the result of r.URL.Query() into the Values without re-encoding,
+// the keys such as "page[size]" are split into the top and nested keys the same way as by ParseValues,
+// the values of a key preserve their order, the keys are processed in the sorted order
+// since the original order of the keys is not kept by url.Values
+func FromURLValues(v url.Values) (Values, error) {
+	return defaultParser.FromURLValues(v)
+}
+
+// parseURLValues builds the values from the already unescaped url.Values, see FromURLValues
+func parseURLValues(v url.Values, opts *options) (Values, []Value, error) {
+	keys := make([]string, 0, len(v))
+	for key := range v {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	b := newValuesBuilder(opts)
+	for _, key := range keys {
+		for _, value := range v[key] {
+			if err := b.addDecoded(key, value); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return b.values, b.ordered, nil
+}
+
+// ParseValuesReader parses the query read from the reader e.g. a form body of a POST request
+// the input is scanned setting by setting, so it is not loaded into memory entirely,
+// the limits such as WithMaxQueryLength and WithMaxValuesPerKey stop the reading as soon as they are exceeded,
+// the read error is wrapped, so it can be checked with errors.Is
+// see ParseValues for the description of the format
+func ParseValuesReader(r io.Reader) (Values, error) {
+	return defaultParser.ParseValuesReader(r)
+}
+
+// parseValuesReader is the streaming counterpart of parseValues
+func parseValuesReader(r io.Reader, opts *options) (Values, []Value, error) {
+	b := newValuesBuilder(opts)
+	br := bufio.NewReader(r)
+	var setting strings.Builder
+	read := 0
+	// prefix is the length of the trimmed leading part, the positions are reported relative to the trimmed query
+	prefix := -1
+	for {
+		c, err := br.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("qparser: failed to read query: %w", err)
+		}
+		read++
+		if opts.maxQueryLength > 0 && read > opts.maxQueryLength {
+			return nil, nil, errQueryTooLong(opts.maxQueryLength)
+		}
+		if c != '&' && c != ';' {
+			setting.WriteByte(c)
+			continue
+		}
+		key := setting.String()
+		setting.Reset()
+		if prefix < 0 {
+			trimmed := trimQueryPrefix(key)
+			prefix, key = len(key)-len(trimmed), trimmed
+		}
+		if err = b.add(key, true, read-1-prefix); err != nil {
+			return nil, nil, err
+		}
+	}
+	key := setting.String()
+	if prefix < 0 {
+		key = trimQueryPrefix(key)
+	}
+	if err := b.add(strings.TrimRightFunc(key, unicode.IsSpace), false, 0); err != nil {
+		return nil, nil, err
 	}
-	return values, nil
+	return b.values, b.ordered, nil
 }
 
 // ParseQuery parses a string and returns a structure filled with the corresponding values
@@ -213,20 +778,29 @@ func ParseValues(query string) (Values, error) {
 // Query can contain nested keys, which are defined by square brackets,
 // for example: page[size], page[number]
 func ParseQuery(query string) (*Query, error) {
-	values, err := ParseValues(query)
-	if err != nil {
-		return nil, err
-	}
-	result := &Query{
-		Includes: initIncludes(values),
-		Fields:   initResourceFields(values),
-		Sort:     initSort(values),
-		Filters:  initFilters(values),
-		Page:     initPage(values),
-		Values:   values,
-	}
+	return defaultParser.ParseQuery(query)
+}
 
-	return result, nil
+// ParseQueryWithOptions works like ParseQuery, but the query is parsed according to the given options
+// e.g. WithPageKeyword("pagination"), the result is the same as ParseQuery's one if no options are given
+// the Parser created by NewParser should be reused instead if the same options are applied to many queries
+func ParseQueryWithOptions(query string, opts ...Option) (*Query, error) {
+	return NewParser(opts...).ParseQuery(query)
+}
+
+// ParseQueryFromURLValues works like ParseQuery, but the query is given as url.Values, see FromURLValues
+func ParseQueryFromURLValues(v url.Values) (*Query, error) {
+	return defaultParser.ParseQueryFromURLValues(v)
+}
+
+// ParseQueryKeywords works like ParseQuery, but only the given keywords e.g. "page", "sort" are parsed,
+// the fields of the query which correspond to the other keywords are left empty, Values are always populated
+// the configured keywords are expected e.g. the one set by WithHavingKeyword, the handlers of the other keywords
+// are not called, unknown keywords are ignored, an alias set by WithIncludeAliases requests the includes
+// the soft deletion flags are read separately, e.g. only the "onlyTrashed" flag makes up the TrashScope
+// if the "withTrashed" keyword is not given
+func ParseQueryKeywords(query string, keywords ...string) (*Query, error) {
+	return defaultParser.ParseQueryKeywords(query, keywords...)
 }
 
 // ParseRequest parses the string into a path and a query,
@@ -241,34 +815,78 @@ func ParseQuery(query string) (*Query, error) {
 //
 // for the query part description see "ParseQuery"
 func ParseRequest(params string) (*Request, error) {
-	path, query := split(params, '?', true)
-	request, err := parsePath(path)
-	if err != nil {
-		return nil, err
-	}
-	q, err := ParseQuery(query)
-	if err != nil {
-		return nil, err
-	}
-	request.Query = q
-	return request, nil
+	return defaultParser.ParseRequest(params)
 }
 
-func parsePath(path string) (*Request, error) {
-	var err error
-	path, err = url.PathUnescape(path)
-	if err != nil {
-		return nil, err
-	}
+// ParseRequestWithOptions works like ParseRequest, but the request is parsed according to the given options,
+// see ParseQueryWithOptions
+func ParseRequestWithOptions(params string, opts ...Option) (*Request, error) {
+	return NewParser(opts...).ParseRequest(params)
+}
+
+// ParseRequests parses each of the requests independently like ParseRequest e.g. the operations of a batch endpoint,
+// so an invalid request does not fail the others, both returned slices have the length of the input
+// and the same indexes: the request is nil if the parsing failed and the error is nil if it succeeded
+func ParseRequests(requests []string) ([]*Request, []error) {
+	return defaultParser.ParseRequests(requests)
+}
+
+// ParsePathAndQuery works like ParseRequest but accepts the path and the query separately
+// it is useful when the path and the query are already separated e.g. by a framework,
+// since the path is not split on '?' it may contain an encoded question mark
+func ParsePathAndQuery(path, query string) (*Request, error) {
+	return defaultParser.ParsePathAndQuery(path, query)
+}
+
+// ParseHTTPRequest parses the path and the query of the HTTP request, the escaped path r.URL.EscapedPath()
+// and the raw query r.URL.RawQuery are used, so the segments and the values are unescaped only once
+// the same way as ParseRequest does with the reconstructed string, an error is returned if r or r.URL is nil
+func ParseHTTPRequest(r *http.Request) (*Request, error) {
+	return defaultParser.ParseHTTPRequest(r)
+}
+
+func parsePath(path string, opts *options) (*Request, error) {
 	path = removeExtraDelimiters(path)
 	if path == "" || (len(path) == 1 && path[0] == '/') {
-		return nil, errors.New("qparser: empty path is given, path must have 1-4 segments")
+		return nil, wrapError(ErrEmptyPath, "qparser: empty path is given, path must have 1-4 segments")
 	}
 	if path[0] == '/' {
 		path = path[1:]
 	}
-	requestParts := strings.Split(path, "/")
+	rawParts := strings.Split(path, "/")
+	// the segments are unescaped individually, so an escaped slash '%2F' does not split a segment
+	requestParts := make([]string, len(rawParts))
+	for i, raw := range rawParts {
+		if opts.rawMode {
+			requestParts[i] = raw
+			continue
+		}
+		if opts.decodePlusInPath {
+			// replaced before unescaping, so an escaped plus '%2B' is kept
+			raw = strings.ReplaceAll(raw, "+", " ")
+		}
+		part, err := url.PathUnescape(raw)
+		if err != nil {
+			return nil, wrapError(ErrInvalidPath, "qparser: %s", err.Error())
+		}
+		requestParts[i] = part
+	}
 	request := new(Request)
+	if opts.versionPattern != nil && len(requestParts) > 1 && opts.versionPattern.MatchString(requestParts[0]) {
+		request.Version, requestParts = requestParts[0], requestParts[1:]
+	}
+	if err := checkPathSegments(len(requestParts), opts); err != nil {
+		return nil, err
+	}
+	if opts.nestedPaths && len(requestParts) >= 4 {
+		if err := parseNestedPath(request, requestParts); err != nil {
+			return nil, err
+		}
+		if opts.rawSegments {
+			request.RawSegments = rawParts
+		}
+		return request, nil
+	}
 	switch len(requestParts) {
 	case 1:
 		request.Resource.Type = requestParts[0]
@@ -281,7 +899,8 @@ func parsePath(path string) (*Request, error) {
 		request.RelatedResourceType = requestParts[2]
 	case 4:
 		if requestParts[2] != relationshipsRequest {
-			return nil, fmt.Errorf(
+			return nil, wrapError(
+				ErrInvalidPath,
 				"qparser: path format error, expected the segment 3 of the path is to be '%s' "+
 					"but '%s' is received",
 				relationshipsRequest,
@@ -292,22 +911,124 @@ func parsePath(path string) (*Request, error) {
 		request.Resource.ID = requestParts[1]
 		request.RelationshipType = requestParts[3]
 	default:
-		return nil, fmt.Errorf("unknown path format %q, path must have 1-4 segments", path)
+		return nil, wrapError(ErrInvalidPath, "unknown path format %q, path must have 1-4 segments", path)
+	}
+	if opts.rawSegments {
+		request.RawSegments = rawParts
 	}
 	return request, nil
 }
 
+// checkPathSegments returns an error if the number of the path segments is out of the configured range
+// the maximum is 4 by default or unlimited if the nested paths are enabled
+func checkPathSegments(n int, opts *options) error {
+	if opts.minPathSegments > 0 && n < opts.minPathSegments {
+		return wrapError(ErrInvalidPath, "qparser: path has %d segments, expected at least %d", n, opts.minPathSegments)
+	}
+	max := opts.maxPathSegments
+	if max <= 0 && !opts.nestedPaths {
+		max = 4
+	}
+	if max > 0 && n > max {
+		return wrapError(ErrInvalidPath, "qparser: path has %d segments, expected at most %d", n, max)
+	}
+	return nil
+}
+
+// parseNestedPath fills the request from the path which navigates through the related resources
+// the segments after the primary resource are the pairs of the related resource type and id
+// optionally terminated by the related resource type or by the relationship e.g.
+// "articles/1/comments/5/author" or "articles/1/comments/5/relationships/author"
+func parseNestedPath(request *Request, parts []string) error {
+	request.Resource = Resource{Type: parts[0], ID: parts[1]}
+	rest := parts[2:]
+	for len(rest) > 0 {
+		switch {
+		case rest[0] == relationshipsRequest:
+			if len(rest) != 2 {
+				return wrapError(
+					ErrInvalidPath,
+					"qparser: path format error, expected the segment '%s' is followed by exactly one relationship name",
+					relationshipsRequest,
+				)
+			}
+			request.RelationshipType = rest[1]
+			return nil
+		case len(rest) == 1:
+			request.RelatedResourceType = rest[0]
+			return nil
+		}
+		request.NestedResources = append(request.NestedResources, Resource{Type: rest[0], ID: rest[1]})
+		rest = rest[2:]
+	}
+	return nil
+}
+
 const (
-	fieldsDelimiter = ","
-	pageKeyword     = "page"
-	sortKeyword     = "sort"
-	filterKeyword   = "filter"
-	includeKeyword  = "include"
-	fieldsKeyword   = "fields"
+	fieldsDelimiter  = ","
+	fieldExcludeChar = '-'
+	fieldsWildcard   = "*"
+	pageKeyword      = "page"
+	sortKeyword      = "sort"
+	filterKeyword    = "filter"
+	includeKeyword   = "include"
+	fieldsKeyword    = "fields"
+	formatKeyword    = "format"
+	deletedKeyword   = "withTrashed"
+	havingKeyword    = "having"
+	localeKeyword    = "locale"
+	countsKeyword    = "counts"
+	profileKeyword   = "profile"
+	idsKeyword       = "ids"
+	requestIDKeyword = "requestId"
 )
 
-func initResourceFields(values Values) ResourceFields {
-	fieldsValues, ok := values[fieldsKeyword]
+// onlyTrashedKeyword is the flag which requests only soft-deleted records, see TrashScopeOnly
+const onlyTrashedKeyword = "onlyTrashed"
+
+// profileDelimiters separate the profiles, the JSON:API specification requires a space which is sent as '+' or "%20"
+const profileDelimiters = " ,"
+
+// initResourceFields populates a list of requested fields by the resource type
+// field names prefixed by the '-' char are treated as excluded and skipped, see initExcludedFields
+func initResourceFields(values Values, opts *options) ResourceFields {
+	return collectResourceFields(values, false, opts)
+}
+
+// initExcludedFields populates a list of fields excluded from the response by the resource type
+// 'fields[articles]=-secret' = ResourceFields{"articles": {"secret"}}
+func initExcludedFields(values Values, opts *options) ResourceFields {
+	return collectResourceFields(values, true, opts)
+}
+
+// limitResourceFields applies the maximum number of the requested fields per resource, the list which exceeds
+// the limit is truncated or, in the strict mode, results in an error
+func limitResourceFields(fields ResourceFields, opts *options) error {
+	if opts.maxFields <= 0 {
+		return nil
+	}
+	for resource, list := range fields {
+		if len(list) <= opts.maxFields {
+			continue
+		}
+		if opts.strict {
+			return wrapError(
+				ErrLimitExceeded,
+				"qparser: too many fields of the resource %q, the maximum is %d",
+				resource,
+				opts.maxFields,
+			)
+		}
+		fields[resource] = list[:opts.maxFields]
+	}
+	return nil
+}
+
+// collectResourceFields reads the "fields" values and gathers either the requested fields
+// or the excluded fields (prefixed by the '-' char, the prefix is removed)
+// duplicates are skipped unless the WithKeepDuplicateFields option is enabled
+func collectResourceFields(values Values, excluded bool, opts *options) ResourceFields {
+	fieldsValues, ok := values[opts.fieldsKeyword]
 	if !ok {
 		return nil
 	}
@@ -316,16 +1037,24 @@ func initResourceFields(values Values) ResourceFields {
 	duplicates := make(map[string]map[string]struct{})
 	returnFields := false
 	for _, val := range fieldsValues {
-		if val.Value == "" || len(val.NestedKeys) != 1 {
+		if len(val.NestedKeys) != 1 {
 			continue
 		}
 		resourceType := val.NestedKeys[0]
+		if val.Value == "" {
+			// 'fields[articles]=' explicitly requests no fields, which differs from the absent fieldset
+			if _, ok := fields[resourceType]; !ok && !excluded {
+				fields[resourceType] = []string{}
+				returnFields = true
+			}
+			continue
+		}
 		byResource, ok := duplicates[resourceType]
 		if !ok {
 			duplicates[resourceType] = make(map[string]struct{})
 			byResource = duplicates[resourceType]
 		}
-		list := strings.Split(val.Value, fieldsDelimiter)
+		list := strings.Split(val.Value, opts.fieldsDelimiter)
 		toAppend := make([]string, 0, len(list))
 
 		// append only not empty and unique values
@@ -333,7 +1062,18 @@ func initResourceFields(values Values) ResourceFields {
 			if item == "" {
 				continue
 			}
-			if _, duplicated := byResource[item]; duplicated {
+			isExcluded := item[0] == fieldExcludeChar
+			if isExcluded != excluded {
+				continue
+			}
+			if isExcluded {
+				item = item[1:]
+			}
+			item = opts.fieldName(item)
+			if item == "" {
+				continue
+			}
+			if _, duplicated := byResource[item]; duplicated && !opts.keepDuplicateFields {
 				continue
 			}
 			toAppend = append(toAppend, item)
@@ -359,13 +1099,19 @@ func initResourceFields(values Values) ResourceFields {
 const (
 	sortDelimiter = ','
 	sortDescChar  = '-'
+	sortAscChar   = '+'
+
+	nullsFirstSuffix = ".nullsfirst"
+	nullsLastSuffix  = ".nullslast"
 )
 
 // initSort populates a list of sort fields and directions
-// if a field name is prefixed by the '-' char then the sorting direction
-// is treated as descending
-func initSort(values Values) []Sort {
-	sortValues, ok := values[sortKeyword]
+// if a field name is prefixed by the descending prefix ('-' by default) then the sorting direction
+// is treated as descending, the '+' prefix explicitly marks the ascending direction,
+// only one prefix is stripped e.g. "++title" results in the "+title" field
+// note that '+' in a query string is decoded as a space, so the prefix is sent as "%2B"
+func initSort(values Values, opts *options) []Sort {
+	sortValues, ok := values[opts.sortKeyword]
 	if !ok {
 		return nil
 	}
@@ -376,31 +1122,57 @@ func initSort(values Values) []Sort {
 		if val.Value == "" || len(val.NestedKeys) != 0 {
 			continue
 		}
-		cur, rest := split(val.Value, sortDelimiter, true)
-		for cur != "" {
+		// empty tokens such as "a,,b" are skipped instead of terminating the list
+		for rest := val.Value; rest != ""; {
+			var cur string
+			cur, rest = cut(rest, opts.sortDelimiter)
 			order := OrderAsc
-			if cur[0] == sortDescChar {
+			explicit := true
+			switch {
+			case strings.HasPrefix(cur, opts.sortDescPrefix):
 				order = OrderDesc
+				cur = cur[len(opts.sortDescPrefix):]
+			case cur != "" && cur[0] == sortAscChar:
 				cur = cur[1:]
+			default:
+				explicit = false
 			}
-			if _, exist := duplicates[cur]; exist {
-				cur, rest = split(rest, sortDelimiter, true)
-				continue
+			nulls := NullsDefault
+			switch {
+			case strings.HasSuffix(cur, nullsFirstSuffix):
+				nulls = NullsFirst
+				cur = cur[:len(cur)-len(nullsFirstSuffix)]
+			case strings.HasSuffix(cur, nullsLastSuffix):
+				nulls = NullsLast
+				cur = cur[:len(cur)-len(nullsLastSuffix)]
+			}
+			var fn string
+			if opts.sortFunctions {
+				fn, cur = splitSortFunc(cur)
 			}
+			cur = opts.fieldName(cur)
 			if cur == "" {
-				cur, rest = split(rest, sortDelimiter, true)
+				continue
+			}
+			key := cur
+			if fn != "" {
+				key = fn + "(" + cur + ")"
+			}
+			if _, exist := duplicates[key]; exist {
 				continue
 			}
 			returnSort = true
-			duplicates[cur] = struct{}{}
+			duplicates[key] = struct{}{}
 			sort = append(
 				sort,
 				Sort{
-					FieldName: cur,
-					Order:     order,
+					FieldName:     cur,
+					Func:          fn,
+					Order:         order,
+					NullsOrder:    nulls,
+					ExplicitOrder: explicit,
 				},
 			)
-			cur, rest = split(rest, sortDelimiter, true)
 		}
 	}
 	if returnSort {
@@ -409,9 +1181,34 @@ func initSort(values Values) []Sort {
 	return nil
 }
 
+// splitSortFunc splits the function call form "fn(field)" into the function name and the field name
+// if the expression is not a function call then the function name is empty and the expression is returned as is
+func splitSortFunc(expr string) (string, string) {
+	i := strings.IndexByte(expr, '(')
+	if i <= 0 || expr[len(expr)-1] != ')' {
+		return "", expr
+	}
+	fn, field := expr[:i], expr[i+1:len(expr)-1]
+	if field == "" || strings.ContainsAny(field, "()") || strings.ContainsAny(fn, "()") {
+		return "", expr
+	}
+	return fn, field
+}
+
 // initFilters fills a list of filters
-func initFilters(values Values) []Filter {
-	filterValues, ok := values[filterKeyword]
+func initFilters(values Values, opts *options) []Filter {
+	return initKeywordFilters(values, opts.filterKeyword, opts)
+}
+
+// initHaving parses the filters of the aggregated values e.g. 'having[total]=gt:100', see initFilters
+func initHaving(values Values, opts *options) []Filter {
+	return initKeywordFilters(values, opts.havingKeyword, opts)
+}
+
+// initKeywordFilters parses the values of the keyword which have exactly one nested key into the filters,
+// the values with the operator as the second nested key are parsed as well if it is enabled
+func initKeywordFilters(values Values, keyword string, opts *options) []Filter {
+	filterValues, ok := values[keyword]
 	if !ok {
 		return nil
 	}
@@ -419,14 +1216,19 @@ func initFilters(values Values) []Filter {
 	returnFilters := false
 
 	for _, val := range filterValues {
-		if val.Value == "" || len(val.NestedKeys) != 1 {
+		if val.Value == "" || !isFilterShape(val.NestedKeys, opts.operatorInKey) {
 			continue
 		}
 		returnFilters = true
 		filter := Filter{
-			FieldName: val.NestedKeys[0],
+			FieldName: opts.fieldName(val.NestedKeys[0]),
 			Predicate: val.Value,
 		}
+		// 'filter[price][gte]=10' is the same as 'filter[price]=gte:10'
+		if len(val.NestedKeys) == 2 && val.NestedKeys[1] != "" {
+			filter.Predicate = val.NestedKeys[1] + string(operatorDelimiter) + val.Value
+		}
+		filter.Op, filter.Value, _ = filter.Operator()
 		filters = append(filters, filter)
 	}
 	if returnFilters {
@@ -435,9 +1237,40 @@ func initFilters(values Values) []Filter {
 	return nil
 }
 
+// isFilterShape reports whether the nested keys of a filter value are either the field name
+// or, if operatorInKey is set, the field name followed by the operator
+func isFilterShape(nestedKeys []string, operatorInKey bool) bool {
+	return len(nestedKeys) == 1 || operatorInKey && len(nestedKeys) == 2
+}
+
 const (
 	relationDelimiter       = ','
 	nestedRelationDelimiter = '.'
+	includeExcludeChar      = '-'
+)
+
+// UTF8Mode determines how the invalid UTF-8 sequences of the query param names and values are handled
+type UTF8Mode int
+
+const (
+	// UTF8Keep keeps the names and the values as is
+	UTF8Keep UTF8Mode = iota
+	// UTF8Reject makes the parsing fail if a name or a value is not a valid UTF-8 string
+	UTF8Reject
+	// UTF8Replace replaces each run of the invalid bytes with the replacement character U+FFFD
+	UTF8Replace
+)
+
+// IncludeCase determines how the relation names of the includes are compared and stored
+type IncludeCase int
+
+const (
+	// IncludeCaseSensitive compares the relations as is, "Author" and "author" are different includes
+	IncludeCaseSensitive IncludeCase = iota
+	// IncludeCaseLower merges the relations case-insensitively and converts them to lower case
+	IncludeCaseLower
+	// IncludeCasePreserve merges the relations case-insensitively and keeps the first received spelling
+	IncludeCasePreserve
 )
 
 // initIncludes creates a list of structures that can include nested lists
@@ -474,8 +1307,27 @@ const (
 //	}
 //
 // ]
-func initIncludes(values Values) []Include {
-	incValues, ok := values[includeKeyword]
+// the paths prefixed by the '-' char are treated as excluded and skipped, see initExcludedIncludes
+func initIncludes(values Values, opts *options) []Include {
+	return collectIncludes(values, false, opts)
+}
+
+// initExcludedIncludes builds the tree of the include paths prefixed by the '-' char, the prefix is removed
+// 'include=author,-comments.likes' = []Include{{Relation: "comments", Includes: []Include{{Relation: "likes"}}}}
+// nil is returned if there are no excluded paths
+func initExcludedIncludes(values Values, opts *options) []Include {
+	return collectIncludes(values, true, opts)
+}
+
+// collectIncludes reads the include values and builds the tree of either the included or the excluded paths
+func collectIncludes(values Values, excluded bool, opts *options) []Include {
+	incValues, ok := values[opts.includeKeyword]
+	for _, alias := range opts.includeAliases {
+		if aliasValues, exist := values[alias]; exist {
+			incValues = append(incValues[:len(incValues):len(incValues)], aliasValues...)
+			ok = true
+		}
+	}
 	if !ok {
 		return nil
 	}
@@ -483,25 +1335,45 @@ func initIncludes(values Values) []Include {
 	roots := make(map[string]*Include)
 	// this slice is needed in order to preserve order of includes
 	ordered := make([]*Include, 0)
+	// the paths of the other kind are skipped, 'include=-comments' alone requests no changes of the included paths
+	skipped := false
 	for _, val := range incValues {
 		if len(val.NestedKeys) > 0 || val.Value == "" {
 			continue
 		}
-		cur, rest := split(val.Value, relationDelimiter, true)
-		for cur != "" {
+		cur, rest := cut(val.Value, opts.relationDelimiter)
+		for ; cur != ""; cur, rest = cut(rest, opts.relationDelimiter) {
+			isExcluded := cur[0] == includeExcludeChar
+			if isExcluded != excluded {
+				skipped = true
+				continue
+			}
+			if isExcluded {
+				cur = cur[1:]
+			}
+			if cur == "" {
+				continue
+			}
 			var root *Include
-			rootKey, next := split(cur, nestedRelationDelimiter, true)
-			if existingRoot, ok := roots[rootKey]; ok {
+			rootKey, next := cut(cur, opts.nestedRelationDelimiter)
+			rootKey = opts.relation(rootKey)
+			foldedKey := rootKey
+			if opts.includeCase != IncludeCaseSensitive {
+				foldedKey = strings.ToLower(rootKey)
+			}
+			if existingRoot, ok := roots[foldedKey]; ok {
 				root = existingRoot
 			} else {
 				root = &Include{Relation: rootKey}
-				roots[rootKey] = root
+				roots[foldedKey] = root
 				ordered = append(ordered, root)
 			}
-			expandInclude(root, next)
-			cur, rest = split(rest, relationDelimiter, true)
+			expandInclude(root, next, opts)
 		}
 	}
+	if len(ordered) == 0 && (excluded || skipped) {
+		return nil
+	}
 	includes := make([]Include, 0, len(ordered))
 	for _, include := range ordered {
 		includes = append(includes, *include)
@@ -509,37 +1381,34 @@ func initIncludes(values Values) []Include {
 	return includes
 }
 
-func expandInclude(root *Include, queryPart string) {
-	if queryPart == "" {
-		return
-	}
-	var newRoot *Include // to pass down in recursion
-	cur, rest := split(queryPart, nestedRelationDelimiter, true)
-	// if no include then create a new slice
-	if root.Includes == nil {
-		root.Includes = []Include{{Relation: cur}}
-		newRoot = &root.Includes[0]
-	} else {
+// expandInclude adds the nested relations of the query part to the root, e.g. "author.image"
+// the relations are processed iteratively, so an arbitrary deep include does not grow the stack
+func expandInclude(root *Include, queryPart string, opts *options) {
+	for queryPart != "" {
+		var cur string
+		cur, queryPart = cut(queryPart, opts.nestedRelationDelimiter)
+		cur = opts.relation(cur)
 		// check if the include with the same relation already exists and use it if so
+		var next *Include
 		for i := 0; i < len(root.Includes); i++ {
-			if root.Includes[i].Relation == cur {
-				newRoot = &root.Includes[i]
+			if opts.sameRelation(root.Includes[i].Relation, cur) {
+				next = &root.Includes[i]
 				break
 			}
 		}
 		// otherwise add a new one
-		if newRoot == nil {
+		if next == nil {
 			root.Includes = append(root.Includes, Include{Relation: cur})
-			newRoot = &root.Includes[len(root.Includes)-1]
+			next = &root.Includes[len(root.Includes)-1]
 		}
+		root = next
 	}
-	expandInclude(newRoot, rest)
 }
 
-func initPage(values Values) *Page {
-	pageValues, ok := values[pageKeyword]
+func initPage(values Values, opts *options) (*Page, error) {
+	pageValues, ok := values[opts.pageKeyword]
 	if !ok {
-		return nil
+		return nil, nil
 	}
 	returnPage := false
 	page := new(Page)
@@ -563,12 +1432,54 @@ func initPage(values Values) *Page {
 		case "cursor":
 			returnPage = true
 			page.Cursor = val.Value
+		case "from":
+			returnPage = true
+			page.From = val.Value
+		case "to":
+			returnPage = true
+			page.To = val.Value
+		case "direction":
+			direction, err := initCursorDirection(val.Value, opts)
+			if err != nil {
+				return nil, err
+			}
+			// an empty or ignored unknown direction alone does not request the pagination
+			if direction != "" {
+				returnPage = true
+				page.CursorDirection = direction
+			}
 		}
 	}
 	if returnPage {
-		return page
+		page.unbounded = opts.unboundedPageSize != "" && page.Size == opts.unboundedPageSize
+		page.maxValue = opts.maxPageValue
+		return page, nil
 	}
-	return nil
+	return nil, nil
+}
+
+// isPageParam reports whether the nested key of the page keyword is parsed into the Page e.g. "size" of 'page[size]'
+func isPageParam(name string) bool {
+	switch name {
+	case "size", "number", "limit", "offset", "cursor", "from", "to", "direction":
+		return true
+	}
+	return false
+}
+
+// initCursorDirection normalizes the page[direction] value to CursorNext or CursorPrev,
+// an empty or unknown value results in the empty direction, an unknown value is an error in the strict mode
+func initCursorDirection(value string, opts *options) (string, error) {
+	switch direction := strings.ToLower(value); direction {
+	case "":
+		return "", nil
+	case CursorNext, CursorPrev:
+		return direction, nil
+	}
+	if opts.strict {
+		return "", wrapError(ErrInvalidValue, "qparser: page[direction] %q is not a cursor direction, expected one of: %s, %s", value, CursorNext, CursorPrev)
+	}
+	return "", nil
 }
 
 const (
@@ -583,34 +1494,84 @@ const (
 // nested keys must be enclosed in square brackets, double opening or closing square brackets or any characters
 // between the closing and opening brackets are not allowed
 // any violation of this syntax is interpreted as absence of nested keys and the
-// given argument string is returned as a top-level key unchanged
+// given argument string is returned as a top-level key unchanged, except an unclosed trailing bracket
+// which is dropped e.g. "page[size][x" results in "page", []string{"size"}
 func extractKeys(key string) (string, []string) {
-	if key == "" {
+	topKey, nestedKeys, _ := splitKeys(key, 0)
+	if topKey == "" {
 		return key, nil
 	}
+	return topKey, nestedKeys
+}
+
+// KeySyntaxError describes a violation of the nested keys syntax of a query param name
+// Pos is the byte position of the violation within the Key
+type KeySyntaxError struct {
+	Key string
+	Pos int
+	Msg string
+}
+
+func (e *KeySyntaxError) Error() string {
+	return fmt.Sprintf("qparser: malformed query param name %q: %s at position %d", e.Key, e.Msg, e.Pos)
+}
+
+// Is reports the syntax violation as ErrMalformedQuery
+func (e *KeySyntaxError) Is(target error) bool {
+	return target == ErrMalformedQuery
+}
+
+// checkBlankKeys returns *KeySyntaxError if the top key or one of the nested keys is empty or consists of whitespace
+func checkBlankKeys(key, topKey string, nestedKeys []string) error {
+	if strings.TrimSpace(topKey) == "" {
+		return &KeySyntaxError{Key: key, Pos: 0, Msg: "blank top-level key"}
+	}
+	pos := len(topKey)
+	for _, nested := range nestedKeys {
+		if strings.TrimSpace(nested) == "" {
+			return &KeySyntaxError{Key: key, Pos: pos + 1, Msg: "blank nested key"}
+		}
+		pos += len(nested) + 2
+	}
+	return nil
+}
+
+// splitKeys works like extractKeys, but reports the syntax violation as *KeySyntaxError
+// the unclosed trailing bracket is reported along with the top key and the nested keys before it
+// unless the remainder is too short to be a nested key e.g. "k[n", the empty top key is returned otherwise
+// positive maxNested limits the number of the nested keys, the scanning stops as soon as the limit is exceeded
+func splitKeys(key string, maxNested int) (string, []string, error) {
+	if key == "" {
+		return key, nil, nil
+	}
 	var rest string
-	topKey := make([]byte, 0, len(key))
 	for i := 0; i < len(key); i++ {
 		c := key[i]
-		if c == closeBracket || i == 0 && c == openBracket {
-			return key, nil
+		if c == closeBracket {
+			return "", nil, &KeySyntaxError{Key: key, Pos: i, Msg: "unexpected ']'"}
 		}
 		if c == openBracket {
+			if i == 0 {
+				return "", nil, &KeySyntaxError{Key: key, Pos: i, Msg: "unexpected '[', top-level key is empty"}
+			}
 			rest = key[i:]
 			break
 		}
-		topKey = append(topKey, c)
 	}
-	if rest == "" || len(rest) < nestedKeyDefMin {
-		return key, nil
+	if rest == "" {
+		return key, nil, nil
 	}
+	offset := len(key) - len(rest)
 	nestedKey := make([]byte, 0, 16)
 	nestedKeys := make([]string, 0, 4)
 	opened := false
 	for i := 0; i < len(rest); i++ {
 		c := rest[i]
-		if opened && c == openBracket || !opened && c != openBracket {
-			return key, nil
+		if opened && c == openBracket {
+			return "", nil, &KeySyntaxError{Key: key, Pos: offset + i, Msg: "unexpected '['"}
+		}
+		if !opened && c != openBracket {
+			return "", nil, &KeySyntaxError{Key: key, Pos: offset + i, Msg: fmt.Sprintf("unexpected %q, expected '['", c)}
 		}
 		switch c {
 		case openBracket:
@@ -618,7 +1579,15 @@ func extractKeys(key string) (string, []string) {
 			continue
 		case closeBracket:
 			if len(nestedKey) == 0 {
-				return key, nil
+				return "", nil, &KeySyntaxError{Key: key, Pos: offset + i, Msg: "empty nested key"}
+			}
+			if maxNested > 0 && len(nestedKeys) == maxNested {
+				return "", nil, wrapError(
+					ErrLimitExceeded,
+					"qparser: too many nested keys of the query param %q, the maximum is %d",
+					key[:offset],
+					maxNested,
+				)
 			}
 			opened = false
 			nestedKeys = append(nestedKeys, string(nestedKey))
@@ -627,7 +1596,23 @@ func extractKeys(key string) (string, []string) {
 		}
 		nestedKey = append(nestedKey, c)
 	}
-	return string(topKey), nestedKeys
+	if opened {
+		err := &KeySyntaxError{Key: key, Pos: len(key), Msg: "unclosed '['"}
+		if len(rest) < nestedKeyDefMin {
+			return "", nil, err
+		}
+		return key[:offset], nestedKeys, err
+	}
+	return key[:offset], nestedKeys, nil
+}
+
+// listKeySuffix marks the key of a list param e.g. "ids[]=1&ids[]=2"
+const listKeySuffix = "[]"
+
+// isListKey reports whether the key is a top-level key followed by the empty brackets e.g. "ids[]"
+func isListKey(key string) bool {
+	name := strings.TrimSuffix(key, listKeySuffix)
+	return name != key && name != "" && !strings.ContainsAny(name, "[]")
 }
 
 // split slices s into two substrings separated by the first occurrence of
@@ -644,6 +1629,15 @@ func split(s string, sep byte, cutc bool) (string, string) {
 	return s[:i], s[i:]
 }
 
+// cut works like split with cutc set to true, but the separator is a string
+func cut(s, sep string) (string, string) {
+	i := strings.Index(s, sep)
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], s[i+len(sep):]
+}
+
 // removeExtraDelimiters clears the string from the following delimiter characters
 func removeExtraDelimiters(path string) string {
 	const delim = '/'
@@ -0,0 +1,246 @@
+package qparser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Schema describes the constraints of the requests by the resource type
+// see Schema.Validate
+type Schema struct {
+	Resources map[string]ResourceSchema
+}
+
+// ResourceSchema describes the constraints of the resource type
+// Fields is a list of the fields which can be requested with 'fields[type]', the wildcard is always allowed
+// Filterable and Sortable are lists of the fields which can be used in 'filter[field]' and 'sort'
+// Includes is a list of the dot separated relation paths e.g. "comments.author", a path allows its parts as well,
+// so "comments.author" allows "comments"
+// MaxPageSize limits page[size] and page[limit], zero means unlimited
+// Relationships maps the relation names to the resource types e.g. "author": "people",
+// a relation which is absent is treated as the resource type of the same name
+// empty lists allow nothing
+type ResourceSchema struct {
+	Fields        []string
+	Filterable    []string
+	Sortable      []string
+	Includes      []string
+	MaxPageSize   int
+	Relationships map[string]string
+}
+
+// Validate checks the request against the schema, the first violation is returned as *ValidationError
+// the resource type of the request must be described by the schema, the constraints of the primary data type
+// are applied to the filters, having filters, sort fields, includes, excluded includes and page size,
+// i.e. the type of the related resources for '/articles/1/comments' and the relationship linkage
+// for '/articles/1/relationships/comments', the having filters are checked against the filterable fields,
+// the fieldsets are checked against the fields of the corresponding types,
+// the fieldsets keyed by the relation paths must refer to the allowed includes
+// the params of the violations are named by the keywords the query was parsed with,
+// nil schema describes no resource types
+func (s *Schema) Validate(r *Request) error {
+	if r == nil {
+		return &ValidationError{Param: "path", Msg: "request is nil"}
+	}
+	var resources map[string]ResourceSchema
+	if s != nil {
+		resources = s.Resources
+	}
+	resource := r.Resource.Type
+	rs, ok := resources[resource]
+	if ok && (r.IsRelatedResourceRequest() || r.IsRelationshipRequest()) {
+		relation := r.primaryDataType()
+		resource = relation
+		if target, exist := rs.Relationships[relation]; exist {
+			resource = target
+		}
+		rs, ok = resources[resource]
+	}
+	if !ok {
+		return &ValidationError{
+			Param:    "path",
+			Resource: resource,
+			Msg:      fmt.Sprintf("unknown resource type %q", resource),
+		}
+	}
+	q := r.Query
+	if q == nil {
+		return nil
+	}
+	syntax := q.syntax
+	if syntax == nil {
+		syntax = &defaultQuerySyntax
+	}
+	filters := []struct {
+		keyword string
+		list    []Filter
+	}{
+		{keyword: syntax.filterKeyword, list: q.Filters},
+		{keyword: syntax.havingKeyword, list: q.Having},
+	}
+	for _, filter := range filters {
+		for _, f := range filter.list {
+			if !contains(rs.Filterable, f.FieldName) {
+				return &ValidationError{
+					Param:    filter.keyword,
+					Resource: resource,
+					Field:    f.FieldName,
+					Msg:      fmt.Sprintf("filtering by %q is not allowed", f.FieldName),
+				}
+			}
+		}
+	}
+	for _, srt := range q.Sort {
+		if !contains(rs.Sortable, srt.FieldName) {
+			return &ValidationError{
+				Param:    syntax.sortKeyword,
+				Resource: resource,
+				Field:    srt.FieldName,
+				Msg:      fmt.Sprintf("sorting by %q is not allowed", srt.FieldName),
+			}
+		}
+	}
+	for _, includes := range [][]Include{q.Includes, q.ExcludedIncludes} {
+		if err := validateIncludes(syntax.includeKeyword, resource, includes, rs.Includes); err != nil {
+			return err
+		}
+	}
+	if err := validatePageSize(syntax.pageKeyword, resource, q.Page, rs.MaxPageSize); err != nil {
+		return err
+	}
+	for _, fields := range []ResourceFields{q.Fields, q.ExcludedFields} {
+		if err := s.validateFields(syntax.fieldsKeyword, fields, rs.Includes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateFields checks the fieldsets against the fields of the resource types with ResourceFields.Validate,
+// a fieldset keyed by a dot separated relation path e.g. 'fields[comments.author]' is accepted if the path is
+// one of the allowed includes, its fields are not checked since the type of the relation is unknown
+func (s *Schema) validateFields(keyword string, fields ResourceFields, includes []string) error {
+	allowed := make(map[string][]string, len(s.Resources))
+	for resource, rs := range s.Resources {
+		allowed[resource] = rs.Fields
+	}
+	checked := make(ResourceFields, len(fields))
+	for resource, list := range fields {
+		if _, ok := allowed[resource]; !ok && isRelationPath(resource) && includeAllowed(resource, includes) {
+			continue
+		}
+		checked[resource] = list
+	}
+	return checked.validate(keyword, allowed)
+}
+
+// Validate checks the fieldsets against the allowlist of the fields by the resource type, the wildcard is always
+// allowed, the first violation in the order of the resource types and of the fields is returned as *ValidationError,
+// a resource type which is absent from the allowlist is reported as well
+func (r ResourceFields) Validate(allowed map[string][]string) error {
+	return r.validate(fieldsKeyword, allowed)
+}
+
+// validate works like Validate, the params of the violations are named by the given keyword
+func (r ResourceFields) validate(keyword string, allowed map[string][]string) error {
+	resources := make([]string, 0, len(r))
+	for resource := range r {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+	for _, resource := range resources {
+		fields, ok := allowed[resource]
+		if !ok {
+			return &ValidationError{
+				Param:    valueKey(keyword, resource),
+				Resource: resource,
+				Msg:      fmt.Sprintf("unknown resource type %q", resource),
+			}
+		}
+		for _, field := range r[resource] {
+			if field != fieldsWildcard && !contains(fields, field) {
+				return &ValidationError{
+					Param:    valueKey(keyword, resource),
+					Resource: resource,
+					Field:    field,
+					Msg:      fmt.Sprintf("field %q is not allowed", field),
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// validateIncludes checks that every path of the include tree is a part of one of the allowed paths
+func validateIncludes(keyword, resource string, includes []Include, allowed []string) error {
+	for _, path := range includePaths(includes) {
+		if !includeAllowed(path, allowed) {
+			return &ValidationError{
+				Param:    keyword,
+				Resource: resource,
+				Field:    path,
+				Msg:      fmt.Sprintf("including %q is not allowed", path),
+			}
+		}
+	}
+	return nil
+}
+
+// includeAllowed reports whether the path equals to or is a leading part of one of the allowed paths
+func includeAllowed(path string, allowed []string) bool {
+	for _, a := range allowed {
+		if a == path || strings.HasPrefix(a, path+string(nestedRelationDelimiter)) {
+			return true
+		}
+	}
+	return false
+}
+
+// validatePageSize checks page[size] and page[limit] against the maximum, zero maximum means unlimited
+func validatePageSize(keyword, resource string, page *Page, max int) error {
+	if page == nil || max <= 0 {
+		return nil
+	}
+	if page.IsUnbounded() {
+		return &ValidationError{
+			Param:    valueKey(keyword, "size"),
+			Resource: resource,
+			Msg:      fmt.Sprintf("unbounded page is not allowed, the maximum size is %d", max),
+		}
+	}
+	sizes := []struct {
+		name  string
+		parse func() (int, error)
+	}{
+		{name: "size", parse: page.SizeInt},
+		{name: "limit", parse: page.LimitInt},
+	}
+	for _, size := range sizes {
+		n, err := size.parse()
+		if err != nil {
+			return &ValidationError{
+				Param:    valueKey(keyword, size.name),
+				Resource: resource,
+				Msg:      err.Error(),
+			}
+		}
+		if n > max {
+			return &ValidationError{
+				Param:    valueKey(keyword, size.name),
+				Resource: resource,
+				Msg:      fmt.Sprintf("%d exceeds the maximum %d", n, max),
+			}
+		}
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,373 @@
+package qparser
+
+import (
+	"testing"
+)
+
+var testSchema = &Schema{
+	Resources: map[string]ResourceSchema{
+		"articles": {
+			Fields:        []string{"title", "body"},
+			Filterable:    []string{"title", "createdAt"},
+			Sortable:      []string{"createdAt"},
+			Includes:      []string{"author", "comments.author"},
+			MaxPageSize:   100,
+			Relationships: map[string]string{"author": "people"},
+		},
+		"comments": {
+			Fields:     []string{"body"},
+			Filterable: []string{"body"},
+			Sortable:   []string{"postedAt"},
+		},
+		"people": {
+			Fields: []string{"name"},
+		},
+	},
+}
+
+type schemaValidateTest struct {
+	in   string
+	opts []Option
+	out  *ValidationError
+}
+
+var schemaValidateTests = []schemaValidateTest{
+	{
+		in: "/articles?filter[title]=eq:a&sort=-createdAt&include=comments.author,author" +
+			"&fields[articles]=title,-body&fields[people]=*&page[size]=100",
+		out: nil,
+	},
+	{
+		in:  "/articles/1/relationships/comments",
+		out: nil,
+	},
+	{
+		in:  "/tags",
+		out: &ValidationError{Param: "path", Resource: "tags", Msg: `unknown resource type "tags"`},
+	},
+	{
+		in:  "/articles/1/comments?filter[body]=a&sort=postedAt",
+		out: nil,
+	},
+	{
+		in:  "/articles/1/relationships/comments?sort=-postedAt",
+		out: nil,
+	},
+	{
+		in: "/articles/1/comments?sort=createdAt",
+		out: &ValidationError{
+			Param:    "sort",
+			Resource: "comments",
+			Field:    "createdAt",
+			Msg:      `sorting by "createdAt" is not allowed`,
+		},
+	},
+	{
+		in: "/articles/1/author?filter[name]=a",
+		out: &ValidationError{
+			Param:    "filter",
+			Resource: "people",
+			Field:    "name",
+			Msg:      `filtering by "name" is not allowed`,
+		},
+	},
+	{
+		in:  "/articles/1/relationships/tags",
+		out: &ValidationError{Param: "path", Resource: "tags", Msg: `unknown resource type "tags"`},
+	},
+	{
+		in:  "/tags/1/comments",
+		out: &ValidationError{Param: "path", Resource: "tags", Msg: `unknown resource type "tags"`},
+	},
+	{
+		in: "/articles?filter[body]=a",
+		out: &ValidationError{
+			Param:    "filter",
+			Resource: "articles",
+			Field:    "body",
+			Msg:      `filtering by "body" is not allowed`,
+		},
+	},
+	{
+		in: "/articles?sort=title",
+		out: &ValidationError{
+			Param:    "sort",
+			Resource: "articles",
+			Field:    "title",
+			Msg:      `sorting by "title" is not allowed`,
+		},
+	},
+	{
+		in:  "/articles?include=comments",
+		out: nil,
+	},
+	{
+		in: "/articles?include=comments.author.avatar",
+		out: &ValidationError{
+			Param:    "include",
+			Resource: "articles",
+			Field:    "comments.author.avatar",
+			Msg:      `including "comments.author.avatar" is not allowed`,
+		},
+	},
+	{
+		in: "/articles?include=tags",
+		out: &ValidationError{
+			Param:    "include",
+			Resource: "articles",
+			Field:    "tags",
+			Msg:      `including "tags" is not allowed`,
+		},
+	},
+	{
+		in: "/articles?page[size]=101",
+		out: &ValidationError{
+			Param:    "page[size]",
+			Resource: "articles",
+			Msg:      "101 exceeds the maximum 100",
+		},
+	},
+	{
+		in: "/articles?page[limit]=500",
+		out: &ValidationError{
+			Param:    "page[limit]",
+			Resource: "articles",
+			Msg:      "500 exceeds the maximum 100",
+		},
+	},
+	{
+		in: "/articles?page[size]=all",
+		out: &ValidationError{
+			Param:    "page[size]",
+			Resource: "articles",
+			Msg:      "unbounded page is not allowed, the maximum size is 100",
+		},
+	},
+	{
+		in: "/articles?page[size]=ten",
+		out: &ValidationError{
+			Param:    "page[size]",
+			Resource: "articles",
+			Msg:      `qparser: page[size] "ten" is not an integer`,
+		},
+	},
+	{
+		in:  "/people?page[size]=1000",
+		out: nil,
+	},
+	{
+		in: "/articles?fields[people]=email",
+		out: &ValidationError{
+			Param:    "fields[people]",
+			Resource: "people",
+			Field:    "email",
+			Msg:      `field "email" is not allowed`,
+		},
+	},
+	{
+		in:  "/articles?include=comments.author&fields[comments.author]=name,email",
+		out: nil,
+	},
+	{
+		in: "/articles?fields[comments.tags]=name",
+		out: &ValidationError{
+			Param:    "fields[comments.tags]",
+			Resource: "comments.tags",
+			Msg:      `unknown resource type "comments.tags"`,
+		},
+	},
+	{
+		in: "/articles?fields[tags]=name",
+		out: &ValidationError{
+			Param:    "fields[tags]",
+			Resource: "tags",
+			Msg:      `unknown resource type "tags"`,
+		},
+	},
+	{
+		in: "/articles?fields[tags]=name&fields[people]=email&fields[articles]=secret",
+		out: &ValidationError{
+			Param:    "fields[articles]",
+			Resource: "articles",
+			Field:    "secret",
+			Msg:      `field "secret" is not allowed`,
+		},
+	},
+	{
+		in: "/people?filter[name]=a",
+		out: &ValidationError{
+			Param:    "filter",
+			Resource: "people",
+			Field:    "name",
+			Msg:      `filtering by "name" is not allowed`,
+		},
+	},
+	{
+		in: "/articles?having[total]=gt:10",
+		out: &ValidationError{
+			Param:    "having",
+			Resource: "articles",
+			Field:    "total",
+			Msg:      `filtering by "total" is not allowed`,
+		},
+	},
+	{
+		in:  "/articles?having[createdAt]=gt:2015-01-01&include=-comments.author",
+		out: nil,
+	},
+	{
+		in: "/articles?include=author,-comments.likes",
+		out: &ValidationError{
+			Param:    "include",
+			Resource: "articles",
+			Field:    "comments.likes",
+			Msg:      `including "comments.likes" is not allowed`,
+		},
+	},
+	{
+		in:   "/people?where[name]=a",
+		opts: []Option{WithFilterKeyword("where")},
+		out: &ValidationError{
+			Param:    "where",
+			Resource: "people",
+			Field:    "name",
+			Msg:      `filtering by "name" is not allowed`,
+		},
+	},
+	{
+		in:   "/articles?only[articles]=secret",
+		opts: []Option{WithFieldsKeyword("only")},
+		out: &ValidationError{
+			Param:    "only[articles]",
+			Resource: "articles",
+			Field:    "secret",
+			Msg:      `field "secret" is not allowed`,
+		},
+	},
+	{
+		in:   "/articles?p[size]=101",
+		opts: []Option{WithPageKeyword("p")},
+		out: &ValidationError{
+			Param:    "p[size]",
+			Resource: "articles",
+			Msg:      "101 exceeds the maximum 100",
+		},
+	},
+}
+
+func TestSchemaValidate(t *testing.T) {
+	for _, tt := range schemaValidateTests {
+		r, err := NewParser(tt.opts...).ParseRequest(tt.in)
+		if err != nil {
+			t.Fatalf("ParseRequest(%q) returned error %v", tt.in, err)
+		}
+		err = testSchema.Validate(r)
+		if tt.out == nil {
+			if err != nil {
+				t.Errorf("Validate(%q) returned unexpected error %v", tt.in, err)
+			}
+			continue
+		}
+		verr, ok := err.(*ValidationError)
+		if !ok {
+			t.Errorf("Validate(%q) returned %v, want *ValidationError", tt.in, err)
+			continue
+		}
+		if *verr != *tt.out {
+			t.Errorf("Validate(%q):\n\tgot  %+v\n\twant %+v\n", tt.in, verr, tt.out)
+		}
+	}
+
+	if err := testSchema.Validate(nil); err == nil {
+		t.Errorf("Validate(nil) returned nil, want error")
+	}
+
+	var nilSchema *Schema
+	r, err := ParseRequest("/articles")
+	if err != nil {
+		t.Fatalf("ParseRequest(%q) returned error %v", "/articles", err)
+	}
+	verr, ok := nilSchema.Validate(r).(*ValidationError)
+	if !ok || verr.Param != "path" || verr.Resource != "articles" {
+		t.Errorf("Validate() of nil schema returned %v, want the unknown resource type violation", verr)
+	}
+
+	// the fieldsets are kept in a map, the reported violation must not depend on its order
+	const unordered = "/articles?fields[tags]=name&fields[people]=email&fields[articles]=secret"
+	r, err = ParseRequest(unordered)
+	if err != nil {
+		t.Fatalf("ParseRequest(%q) returned error %v", unordered, err)
+	}
+	for i := 0; i < 20; i++ {
+		verr, ok := testSchema.Validate(r).(*ValidationError)
+		if !ok || verr.Resource != "articles" {
+			t.Fatalf("Validate(%q) returned %v, want the violation of the articles fieldset", unordered, verr)
+		}
+	}
+}
+
+var testAllowedFields = map[string][]string{
+	"articles": {"title", "body"},
+	"people":   {"name"},
+}
+
+type fieldsValidateTest struct {
+	in  string
+	out *ValidationError
+}
+
+var fieldsValidateTests = []fieldsValidateTest{
+	{in: ""},
+	{in: "fields[articles]=title,body&fields[people]=name"},
+	{in: "fields[articles]=*&fields[people]="},
+	{
+		in: "fields[articles]=title,secret",
+		out: &ValidationError{
+			Param:    "fields[articles]",
+			Resource: "articles",
+			Field:    "secret",
+			Msg:      `field "secret" is not allowed`,
+		},
+	},
+	{
+		in: "fields[people]=name&fields[comments]=body",
+		out: &ValidationError{
+			Param:    "fields[comments]",
+			Resource: "comments",
+			Msg:      `unknown resource type "comments"`,
+		},
+	},
+	{
+		in: "fields[people]=email&fields[articles]=secret",
+		out: &ValidationError{
+			Param:    "fields[articles]",
+			Resource: "articles",
+			Field:    "secret",
+			Msg:      `field "secret" is not allowed`,
+		},
+	},
+}
+
+func TestResourceFieldsValidate(t *testing.T) {
+	for _, tt := range fieldsValidateTests {
+		q, err := ParseQuery(tt.in)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q) returned error %v", tt.in, err)
+		}
+		err = q.Fields.Validate(testAllowedFields)
+		if tt.out == nil {
+			if err != nil {
+				t.Errorf("Validate() of %q returned unexpected error %v", tt.in, err)
+			}
+			continue
+		}
+		verr, ok := err.(*ValidationError)
+		if !ok {
+			t.Errorf("Validate() of %q returned %v, want *ValidationError", tt.in, err)
+			continue
+		}
+		if *verr != *tt.out {
+			t.Errorf("Validate() of %q:\n\tgot  %+v\n\twant %+v\n", tt.in, verr, tt.out)
+		}
+	}
+}